@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	tl "go-micro/internal/transationLogger"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var eventTypeNames = map[int]string{
+	tl.EventPut:       "put",
+	tl.EventDelete:    "delete",
+	tl.EventExpire:    "expire",
+	tl.EventBatch:     "batch",
+	tl.EventCompacted: "compacted",
+}
+
+// jsonEvent is the line dump prints for an event
+type jsonEvent struct {
+	Id        uint64      `json:"id,omitempty"`
+	Type      string      `json:"type"`
+	Key       string      `json:"key,omitempty"`
+	Value     *string     `json:"value,omitempty"` // set for puts, which may put an empty value
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	Version   uint64      `json:"version,omitempty"`
+	Batch     []jsonEvent `json:"batch,omitempty"`
+}
+
+func newJSONEvent(e tl.Event) jsonEvent {
+	j := jsonEvent{Id: e.Id, Type: eventTypeName(e.EventType), Key: e.Key, Version: e.Version}
+	if e.EventType == tl.EventPut {
+		j.Value = &e.Value
+	}
+	if e.ExpiresAt != 0 {
+		expiresAt := time.Unix(0, e.ExpiresAt).UTC()
+		j.ExpiresAt = &expiresAt
+	}
+	for _, entry := range e.Batch {
+		j.Batch = append(j.Batch, newJSONEvent(entry))
+	}
+	return j
+}
+
+func eventTypeName(eventType int) string {
+	if name, ok := eventTypeNames[eventType]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", eventType)
+}
+
+// logExists checks there is a log at path, a proto log
+// is the segments and the index named after path
+func logExists(path string) error {
+	matches, err := filepath.Glob(path + "*")
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no log at %s", path)
+	}
+	return nil
+}
+
+// openLog opens the log with the logger of the format, the log
+// of a file format must exist unless create is set
+func openLog(format, path string, create bool) (tl.TransactionLogger, error) {
+	if format != "postgres" && !create {
+		if err := logExists(path); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case "file":
+		return tl.NewFileTransactionLogger(path)
+	case "proto":
+		return tl.NewProtoTransactionLogger(path)
+	case "sqlite":
+		return tl.NewSQLiteTransactionLogger(path)
+	case "postgres":
+		db, err := sql.Open("postgres", path)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to db: %s", err)
+		}
+		logger, err := tl.NewPostgresTransactionLoggerFromDB(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return logger, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// contiguous tells if the ids of the format follow each other without gaps,
+// the db backends skip the sequences of batch entries and rolled back inserts
+func contiguous(format string) bool {
+	return format == "file" || format == "proto"
+}
+
+// readLog calls fn with every event of the log, in order, file and proto logs
+// are read without changing them and the problems found are returned, the
+// db logs are read through their loggers, which migrate an outdated schema
+func readLog(format, path string, fn func(tl.Event) error) (tl.Inspection, error) {
+	var inspect func(string, int, func(tl.Event) error) (tl.Inspection, error)
+	switch format {
+	case "file":
+		inspect = tl.InspectFileLog
+	case "proto":
+		inspect = tl.InspectProtoLog
+	}
+	if inspect != nil {
+		if err := logExists(path); err != nil {
+			return tl.Inspection{}, err
+		}
+		inspection, err := inspect(path, tl.DefaultMaxRecordBytes, fn)
+		if err != nil {
+			return inspection, fmt.Errorf("error reading log: %s", err)
+		}
+		return inspection, nil
+	}
+
+	logger, err := openLog(format, path, false)
+	if err != nil {
+		return tl.Inspection{}, err
+	}
+	defer logger.Close(context.Background())
+
+	events, errs := logger.ReadEvents()
+	for e := range events {
+		if err == nil {
+			err = fn(e)
+		}
+	}
+	if err != nil {
+		return tl.Inspection{}, err
+	}
+
+	if err := <-errs; err != nil {
+		return tl.Inspection{}, fmt.Errorf("error reading log: %s", err)
+	}
+	return tl.Inspection{}, nil
+}
+
+// reportProblems prints the problems the inspection of a log found
+func reportProblems(w io.Writer, inspection tl.Inspection) {
+	for _, corrupt := range inspection.Corrupt {
+		fmt.Fprintln(w, corrupt)
+	}
+	for _, torn := range inspection.Torn {
+		fmt.Fprintf(w, "torn record in %s at offset %d\n", torn.Path, torn.Offset)
+	}
+}
+
+// dump prints the events to w and the problems of the log to stderr
+func dump(args []string, w io.Writer) error {
+	format, path, err := parseLogArgs("dump", args)
+	if err != nil {
+		return err
+	}
+
+	out := json.NewEncoder(w)
+	inspection, err := readLog(format, path, func(e tl.Event) error {
+		return out.Encode(newJSONEvent(e))
+	})
+	reportProblems(os.Stderr, inspection)
+	return err
+}
+
+// verify reads the whole log, reports the records failing their checksum and
+// the torn tails, and checks the ids increase, corrupt records leave gaps
+func verify(args []string, w io.Writer) error {
+	format, path, err := parseLogArgs("verify", args)
+	if err != nil {
+		return err
+	}
+
+	var events, problems int
+	var first, last uint64
+	inspection, err := readLog(format, path, func(e tl.Event) error {
+		events++
+		switch {
+		case e.Id <= last && events > 1:
+			fmt.Fprintf(w, "event %d follows event %d\n", e.Id, last)
+			problems++
+		case contiguous(format) && e.Id != last+1 && (events > 1 || e.EventType != tl.EventCompacted):
+			if e.Id == last+2 {
+				fmt.Fprintf(w, "event %d is missing\n", last+1)
+			} else {
+				fmt.Fprintf(w, "events %d to %d are missing\n", last+1, e.Id-1)
+			}
+			problems++
+		}
+		if _, ok := eventTypeNames[e.EventType]; !ok {
+			fmt.Fprintf(w, "event %d has unknown type %d\n", e.Id, e.EventType)
+			problems++
+		}
+
+		if events == 1 {
+			first = e.Id
+		}
+		last = max(last, e.Id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reportProblems(w, inspection)
+	problems += inspection.Problems()
+	if problems > 0 {
+		return fmt.Errorf("%d problems in %d events", problems, events)
+	}
+	fmt.Fprintf(w, "ok: %d events, ids %d to %d\n", events, first, last)
+	return nil
+}
+
+func stats(args []string, w io.Writer) error {
+	format, path, err := parseLogArgs("stats", args)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[int]int)
+	keys := make(map[string]struct{})
+	var events, entries int
+	var first, last uint64
+	inspection, err := readLog(format, path, func(e tl.Event) error {
+		events++
+		if events == 1 {
+			first = e.Id
+		}
+		last = e.Id
+
+		counts[e.EventType]++
+		if e.EventType != tl.EventBatch && e.EventType != tl.EventCompacted {
+			keys[e.Key] = struct{}{}
+		}
+		for _, entry := range e.Batch {
+			entries++
+			keys[entry.Key] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "events:\t%d\n", events)
+	if events > 0 {
+		fmt.Fprintf(w, "ids:\t%d to %d\n", first, last)
+	}
+	for _, eventType := range []int{tl.EventPut, tl.EventDelete, tl.EventExpire, tl.EventBatch, tl.EventCompacted} {
+		fmt.Fprintf(w, "%s:\t%d\n", eventTypeName(eventType), counts[eventType])
+	}
+	fmt.Fprintf(w, "batch entries:\t%d\n", entries)
+	fmt.Fprintf(w, "keys:\t%d\n", len(keys))
+	fmt.Fprintf(w, "corrupt records:\t%d\n", len(inspection.Corrupt))
+	fmt.Fprintf(w, "torn tails:\t%d\n", len(inspection.Torn))
+
+	if format != "postgres" {
+		size, err := logSize(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "size:\t%d bytes\n", size)
+	}
+	return nil
+}
+
+// logSize sums up the files of the log, the segments and index
+// of a proto log and the WAL of a sqlite one are named after path
+func logSize(path string) (int64, error) {
+	matches, err := filepath.Glob(path + "*")
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil {
+			return 0, err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// convert writes the events of src into the empty log dst, the events
+// get the ids of dst, which match the source unless it was compacted
+func convert(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := flags.String("from", "proto", "source format: file, proto, sqlite or postgres")
+	to := flags.String("to", "file", "destination format: file, proto, sqlite or postgres")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected a source and a destination, got %d arguments", flags.NArg())
+	}
+
+	if *from != "postgres" {
+		if err := logExists(flags.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	dst, err := openLog(*to, flags.Arg(1), true)
+	if err != nil {
+		return err
+	}
+	if dst.GetLastEventId() != 0 {
+		dst.Close(context.Background())
+		return errors.New("the destination log is not empty")
+	}
+	dst.Run()
+
+	var written uint64
+	renumbered := false
+	inspection, err := readLog(*from, flags.Arg(0), func(e tl.Event) error {
+		switch e.EventType {
+		case tl.EventPut:
+			if e.ExpiresAt != 0 {
+				dst.WritePutWithExpiry(e.Key, e.Value, e.Version, time.Unix(0, e.ExpiresAt))
+			} else {
+				dst.WritePut(e.Key, e.Value, e.Version)
+			}
+		case tl.EventDelete:
+			dst.WriteDel(e.Key, e.Version)
+		case tl.EventExpire:
+			dst.WriteExpire(e.Key, e.Version)
+		case tl.EventBatch:
+			dst.WriteBatch(e.Batch)
+		case tl.EventCompacted:
+			fmt.Fprintf(os.Stderr, "the source is compacted up to event %d, "+
+				"the events before it are only in its snapshots\n", e.Id)
+			return nil
+		default:
+			return fmt.Errorf("event %d has unknown type %d", e.Id, e.EventType)
+		}
+
+		written++
+		renumbered = renumbered || e.Id != written
+		return nil
+	})
+	reportProblems(os.Stderr, inspection)
+
+	// the queued events are written even if reading failed half way
+	if closeErr := dst.Close(context.Background()); closeErr != nil && err == nil {
+		err = fmt.Errorf("error writing destination: %s", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if renumbered {
+		fmt.Fprintln(os.Stderr, "event ids were renumbered, snapshots of the source do not apply to the destination")
+	}
+	fmt.Fprintf(w, "converted %d events\n", written)
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	tl "go-micro/internal/transationLogger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLog writes a put of every key to a new log of the format
+func writeLog(t *testing.T, format, path string, keys ...string) {
+	logger, err := openLog(format, path, true)
+	assert.NoError(t, err)
+	logger.Run()
+
+	ctx := context.Background()
+	for _, key := range keys {
+		assert.NoError(t, logger.WritePutContext(ctx, key, "value of "+key, 1, time.Time{}))
+	}
+	assert.NoError(t, logger.Close(ctx))
+}
+
+// snapshotDir returns the content of every file of the directory
+func snapshotDir(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		assert.NoError(t, err)
+		files[entry.Name()] = string(data)
+	}
+	return files
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		damage  func(t *testing.T, path string)
+		output  []string
+		problem string
+	}{
+		{
+			name:   "intact proto log",
+			format: "proto",
+			damage: func(t *testing.T, path string) {},
+			output: []string{"ok: 3 events, ids 1 to 3"},
+		}, {
+			name:   "corrupt proto record",
+			format: "proto",
+			damage: func(t *testing.T, path string) {
+				// the first byte of the data of the first record, after the magic and its header
+				segment := path + ".000001"
+				data, err := os.ReadFile(segment)
+				assert.NoError(t, err)
+				data[16] ^= 0xff
+				assert.NoError(t, os.WriteFile(segment, data, 0644))
+			},
+			output:  []string{"corrupt record in", "at offset 8", "event 1 is missing"},
+			problem: "2 problems in 2 events",
+		}, {
+			name:   "torn proto tail",
+			format: "proto",
+			damage: func(t *testing.T, path string) {
+				segment := path + ".000001"
+				info, err := os.Stat(segment)
+				assert.NoError(t, err)
+				assert.NoError(t, os.Truncate(segment, info.Size()-3))
+			},
+			output:  []string{"torn record in"},
+			problem: "1 problems in 2 events",
+		}, {
+			name:   "intact file log",
+			format: "file",
+			damage: func(t *testing.T, path string) {},
+			output: []string{"ok: 3 events, ids 1 to 3"},
+		}, {
+			name:   "torn file tail",
+			format: "file",
+			damage: func(t *testing.T, path string) {
+				info, err := os.Stat(path)
+				assert.NoError(t, err)
+				assert.NoError(t, os.Truncate(path, info.Size()-3))
+			},
+			output:  []string{"torn record in"},
+			problem: "1 problems in 2 events",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "transaction.log")
+			writeLog(t, tc.format, path, "a", "b", "c")
+			tc.damage(t, path)
+			before := snapshotDir(t, dir)
+
+			var out bytes.Buffer
+			err := verify([]string{"-format", tc.format, path}, &out)
+			if tc.problem == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.problem)
+			}
+			for _, line := range tc.output {
+				assert.Contains(t, out.String(), line)
+			}
+
+			// the log is only read
+			assert.Equal(t, before, snapshotDir(t, dir))
+		})
+	}
+}
+
+func TestDumpLegacyFileLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "transaction.log")
+	legacy := "1\t0\tuser\talice\n2\t1\tuser\t\n"
+	assert.NoError(t, os.WriteFile(path, []byte(legacy), 0644))
+
+	var out bytes.Buffer
+	err := dump([]string{"-format", "file", path}, &out)
+	assert.NoError(t, err)
+
+	var events []jsonEvent
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var e jsonEvent
+		assert.NoError(t, decoder.Decode(&e))
+		events = append(events, e)
+	}
+	alice := "alice"
+	assert.Equal(t, []jsonEvent{
+		{Id: 1, Type: "put", Key: "user", Value: &alice},
+		{Id: 2, Type: "delete", Key: "user"},
+	}, events)
+
+	// the legacy log is not upgraded
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, legacy, string(data))
+}
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "transaction.log")
+	writeLog(t, "proto", path, "a", "b", "a")
+
+	var out bytes.Buffer
+	err := stats([]string{"-format", "proto", path}, &out)
+	assert.NoError(t, err)
+	for _, line := range []string{"events:\t3\n", "ids:\t1 to 3\n", "put:\t3\n", "keys:\t2\n", "corrupt records:\t0\n", "torn tails:\t0\n"} {
+		assert.Contains(t, out.String(), line)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "transaction.log")
+	dst := filepath.Join(dir, "transaction.txt")
+	writeLog(t, "proto", src, "a", "b", "c")
+
+	var out bytes.Buffer
+	err := convert([]string{"-from", "proto", "-to", "file", src, dst}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "converted 3 events\n", out.String())
+
+	var keys []string
+	_, err = readLog("file", dst, func(e tl.Event) error {
+		keys = append(keys, e.Key)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	// a missing source leaves no destination behind
+	missing := filepath.Join(dir, "missing.txt")
+	err = convert([]string{"-from", "file", "-to", "file", filepath.Join(dir, "none"), missing}, &out)
+	assert.ErrorContains(t, err, "no log at")
+	assert.NoFileExists(t, missing)
+}
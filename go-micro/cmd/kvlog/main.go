@@ -0,0 +1,63 @@
+// kvlog inspects and converts transaction logs without running the server
+//
+//	kvlog dump    [-format proto] <log>
+//	kvlog verify  [-format proto] <log>
+//	kvlog stats   [-format proto] <log>
+//	kvlog convert [-from proto] [-to file] <src> <dst>
+//
+// the formats are the logger backends of the server: file, proto, sqlite
+// and postgres, the log of a postgres backend is a lib/pq connection string.
+// file and proto logs are read without changing them, legacy formats are
+// left as they are and torn tails are reported, the server cuts them off
+// on start, the destination of convert is opened with the regular logger
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage:
+	kvlog dump    [-format proto] <log>   print the events as JSON lines
+	kvlog verify  [-format proto] <log>   check event ids and record checksums
+	kvlog stats   [-format proto] <log>   print event counts, keys and size
+	kvlog convert [-from proto] [-to file] <src> <dst>
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func([]string, io.Writer) error{
+		"dump":    dump,
+		"verify":  verify,
+		"stats":   stats,
+		"convert": convert,
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := command(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "kvlog %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// parseLogArgs parses the flags of the commands reading a single log
+func parseLogArgs(name string, args []string) (format, path string, err error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&format, "format", "proto", "log format: file, proto, sqlite or postgres")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return "", "", fmt.Errorf("expected a single log, got %d arguments", flags.NArg())
+	}
+	return format, flags.Arg(0), nil
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go-micro/internal/api"
+	tl "go-micro/internal/transationLogger"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the server, it is read from the defaults,
+// the yaml file, the KV_* environment variables and the flags, each
+// overriding the ones before, the variable of a flag is its upper cased name
+// prefixed with KV_, for example -logger-path is set by KV_LOGGER_PATH
+type Config struct {
+	Listen          string        `yaml:"listen"`
+	HTTPListen      string        `yaml:"http_listen"` // address of the rest gateway and /metrics, empty disables them
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Logger    LoggerConfig    `yaml:"logger"`
+	Postgres  PostgresConfig  `yaml:"postgres"`
+	Snapshots SnapshotsConfig `yaml:"snapshots"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Log       LogConfig       `yaml:"log"`
+}
+
+type LoggerConfig struct {
+	Backend         string        `yaml:"backend"` // file, proto, sqlite or postgres
+	Path            string        `yaml:"path"`    // log of the file backends, empty for the default of the backend
+	Sync            string        `yaml:"sync"`    // none, interval or always, the db backends always sync
+	SyncInterval    time.Duration `yaml:"sync_interval"`
+	MaxSegmentBytes int64         `yaml:"max_segment_bytes"`
+	Failure         string        `yaml:"failure"` // stop, read-only or retry once the log cannot be written
+}
+
+// PostgresConfig is passed on to lib/pq, which takes
+// the params left empty from the PG* environment variables
+type PostgresConfig struct {
+	Host     string `yaml:"host"`
+	DBName   string `yaml:"db"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	SSLMode  string `yaml:"sslmode"`
+}
+
+type SnapshotsConfig struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// TLSConfig enables tls on the grpc and http listeners if the cert is set, clients must
+// present a certificate signed by the client ca bundle if that is set too,
+// the files are reloaded once they change
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// AuthConfig enables authentication if a token file or jwks is set,
+// or tls requires client certificates, the acl is only allowed then
+type AuthConfig struct {
+	TokensFile  string `yaml:"tokens_file"` // lines of "<token> <principal>"
+	JWKSFile    string `yaml:"jwks_file"`   // keys the JWTs are verified against, the subject is the principal
+	JWTIssuer   string `yaml:"jwt_issuer"`
+	JWTAudience string `yaml:"jwt_audience"`
+	ACLFile     string `yaml:"acl_file"` // empty allows every principal everything
+}
+
+func (c AuthConfig) enabled(tls TLSConfig) bool {
+	return c.TokensFile != "" || c.JWKSFile != "" || tls.ClientCAFile != ""
+}
+
+// TracingConfig picks the exporter of the spans, the otlp exporter also
+// reads the OTEL_EXPORTER_OTLP_* variables, for example for its headers
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"` // none, otlp, stdout or file
+	Endpoint    string  `yaml:"endpoint"` // host:port of the otlp collector, empty for the default of the exporter
+	Insecure    bool    `yaml:"insecure"` // send to the collector without tls
+	File        string  `yaml:"file"`     // spans of the file exporter, one json object per line
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// LogConfig configures the logs of the server written to stderr, and the audit log
+type LogConfig struct {
+	Level     string `yaml:"level"`      // debug, info, warn or error
+	Format    string `yaml:"format"`     // text or json
+	AuditFile string `yaml:"audit_file"` // json lines of the mutating calls, empty disables the audit log
+}
+
+type LimitsConfig struct {
+	MaxRecordBytes int `yaml:"max_record_bytes"` // largest event the file and proto loggers and the api accept
+}
+
+func defaultConfig() Config {
+	return Config{
+		Listen:          ":8080",
+		HTTPListen:      ":8081",
+		ShutdownTimeout: 25 * time.Second,
+		Logger: LoggerConfig{
+			Backend:         "proto",
+			Sync:            "always",
+			SyncInterval:    tl.DefaultSyncPolicy.Interval,
+			MaxSegmentBytes: tl.DefaultProtoLoggerParams.MaxSegmentBytes,
+			Failure:         "stop",
+		},
+		Snapshots: SnapshotsConfig{
+			Dir:      "./snapshots",
+			Interval: time.Minute,
+		},
+		Limits: LimitsConfig{
+			MaxRecordBytes: tl.DefaultMaxRecordBytes,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+}
+
+// defaultLogPaths are the logs of the file backends if no path is configured
+var defaultLogPaths = map[string]string{
+	"file":   "./transaction.txt",
+	"proto":  "./transaction.log",
+	"sqlite": "./transaction.db",
+}
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+var failurePolicies = map[string]tl.FailurePolicy{
+	"stop":      tl.FailStop,
+	"read-only": tl.FailReadOnly,
+	"retry":     tl.FailRetry,
+}
+
+var syncModes = map[string]tl.SyncMode{
+	"none":     tl.SyncNone,
+	"interval": tl.SyncInterval,
+	"always":   tl.SyncAlways,
+}
+
+func newFlagSet(cfg *Config, configFile *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(configFile, "config", "", "yaml configuration file")
+
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "address the grpc server listens on")
+	fs.StringVar(&cfg.HTTPListen, "http-listen", cfg.HTTPListen, "address the rest gateway and /metrics listen on, empty disables them")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout,
+		"time running requests and queued writes get to finish on SIGTERM")
+
+	fs.StringVar(&cfg.Logger.Backend, "logger", cfg.Logger.Backend, "transaction log backend: proto, file, sqlite or postgres")
+	fs.StringVar(&cfg.Logger.Path, "logger-path", cfg.Logger.Path, "log of the file, proto and sqlite backends")
+	fs.StringVar(&cfg.Logger.Sync, "sync", cfg.Logger.Sync,
+		"when the log is fsynced: none, interval or always, writes are acknowledged before the fsync unless always")
+	fs.DurationVar(&cfg.Logger.SyncInterval, "sync-interval", cfg.Logger.SyncInterval, "fsync interval of the interval sync mode")
+	fs.Int64Var(&cfg.Logger.MaxSegmentBytes, "max-segment-bytes", cfg.Logger.MaxSegmentBytes,
+		"size the proto logger rotates its segments at, 0 disables rotation")
+	fs.StringVar(&cfg.Logger.Failure, "logger-failure", cfg.Logger.Failure,
+		"what is done once the log cannot be written: stop the server, serve reads only, or retry opening the log")
+
+	fs.StringVar(&cfg.Postgres.Host, "postgres-host", cfg.Postgres.Host, "postgres host, defaults to PGHOST")
+	fs.StringVar(&cfg.Postgres.DBName, "postgres-db", cfg.Postgres.DBName, "postgres database, defaults to PGDATABASE")
+	fs.StringVar(&cfg.Postgres.User, "postgres-user", cfg.Postgres.User, "postgres user, defaults to PGUSER")
+	fs.StringVar(&cfg.Postgres.Password, "postgres-password", cfg.Postgres.Password,
+		"postgres password, prefer KV_POSTGRES_PASSWORD or PGPASSWORD")
+	fs.StringVar(&cfg.Postgres.SSLMode, "postgres-sslmode", cfg.Postgres.SSLMode, "postgres sslmode, defaults to PGSSLMODE")
+
+	fs.StringVar(&cfg.Snapshots.Dir, "snapshot-dir", cfg.Snapshots.Dir, "directory of the store snapshots")
+	fs.DurationVar(&cfg.Snapshots.Interval, "snapshot-interval", cfg.Snapshots.Interval, "time between snapshots")
+
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert", cfg.TLS.CertFile, "certificate of the grpc and http listeners, enables tls")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key", cfg.TLS.KeyFile, "private key of the certificate")
+	fs.StringVar(&cfg.TLS.ClientCAFile, "tls-client-ca", cfg.TLS.ClientCAFile, "ca bundle client certificates must be signed by, enables mutual tls")
+
+	fs.StringVar(&cfg.Auth.TokensFile, "auth-tokens", cfg.Auth.TokensFile, "file of bearer tokens and their principals, enables auth")
+	fs.StringVar(&cfg.Auth.JWKSFile, "auth-jwks", cfg.Auth.JWKSFile, "jwks file bearer JWTs are verified against, enables auth")
+	fs.StringVar(&cfg.Auth.JWTIssuer, "auth-jwt-issuer", cfg.Auth.JWTIssuer, "issuer the JWTs must have")
+	fs.StringVar(&cfg.Auth.JWTAudience, "auth-jwt-audience", cfg.Auth.JWTAudience, "audience the JWTs must have")
+	fs.StringVar(&cfg.Auth.ACLFile, "acl", cfg.Auth.ACLFile, "yaml policy of the key prefixes principals may access")
+
+	fs.IntVar(&cfg.Limits.MaxRecordBytes, "max-record-bytes", cfg.Limits.MaxRecordBytes, "largest event accepted")
+
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "least level logged: debug, info, warn or error")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "format of the logs: text or json")
+	fs.StringVar(&cfg.Log.AuditFile, "audit-log", cfg.Log.AuditFile, "file the mutating calls are appended to, empty disables the audit log")
+
+	fs.StringVar(&cfg.Tracing.Exporter, "trace-exporter", cfg.Tracing.Exporter, "where spans are exported: none, otlp, stdout or file")
+	fs.StringVar(&cfg.Tracing.Endpoint, "trace-endpoint", cfg.Tracing.Endpoint, "host:port of the otlp collector")
+	fs.BoolVar(&cfg.Tracing.Insecure, "trace-insecure", cfg.Tracing.Insecure, "export to the otlp collector without tls")
+	fs.StringVar(&cfg.Tracing.File, "trace-file", cfg.Tracing.File, "file the file exporter appends the spans to")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", cfg.Tracing.SampleRatio,
+		"share of the traces started here which are sampled, calls of sampled traces are always sampled")
+
+	return fs
+}
+
+// envName is the environment variable of the flag
+func envName(flagName string) string {
+	return "KV_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig reads the configuration, args are the command line arguments
+// without the program name and getenv looks up the environment variables
+func loadConfig(args []string, getenv func(string) string) (Config, error) {
+	cfg := defaultConfig()
+	var configFile string
+	fs := newFlagSet(&cfg, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	// the flags bind the fields of cfg, so the set ones are
+	// remembered and applied again after the file and the environment
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	cfg = defaultConfig()
+	if configFile == "" {
+		configFile = getenv(envName("config"))
+	}
+	if configFile != "" {
+		if err := readConfigFile(configFile, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value := getenv(envName(f.Name))
+		if err != nil || value == "" || f.Name == "config" {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid %s %q: %s", envName(f.Name), value, setErr)
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	for name, value := range set {
+		if err := fs.Set(name, value); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %s", err)
+	}
+	return cfg, nil
+}
+
+// readConfigFile overrides the fields of cfg set in the file, unknown keys are an error
+func readConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %s", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing config file %s: %s", path, err)
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		return fmt.Errorf("listen: %s", err)
+	}
+	if c.HTTPListen != "" {
+		if _, _, err := net.SplitHostPort(c.HTTPListen); err != nil {
+			return fmt.Errorf("http listen: %s", err)
+		}
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive, got %s", c.ShutdownTimeout)
+	}
+
+	if _, ok := defaultLogPaths[c.Logger.Backend]; !ok && c.Logger.Backend != "postgres" {
+		return fmt.Errorf("unknown logger backend %q", c.Logger.Backend)
+	}
+	if _, ok := syncModes[c.Logger.Sync]; !ok {
+		return fmt.Errorf("unknown sync mode %q", c.Logger.Sync)
+	}
+	if err := c.syncPolicy().Validate(); err != nil {
+		return err
+	}
+	if _, ok := failurePolicies[c.Logger.Failure]; !ok {
+		return fmt.Errorf("unknown logger failure policy %q", c.Logger.Failure)
+	}
+	if c.Logger.MaxSegmentBytes < 0 {
+		return fmt.Errorf("max segment bytes must not be negative, got %d", c.Logger.MaxSegmentBytes)
+	}
+
+	if c.Snapshots.Dir == "" {
+		return errors.New("snapshot dir must be set")
+	}
+	if c.Snapshots.Interval <= 0 {
+		return fmt.Errorf("snapshot interval must be positive, got %s", c.Snapshots.Interval)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls cert and key must be set together")
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		return errors.New("tls client ca requires a tls cert")
+	}
+	if c.Auth.ACLFile != "" && !c.Auth.enabled(c.TLS) {
+		return errors.New("acl requires auth tokens, a jwks or a tls client ca")
+	}
+	if (c.Auth.JWTIssuer != "" || c.Auth.JWTAudience != "") && c.Auth.JWKSFile == "" {
+		return errors.New("jwt issuer and audience require a jwks")
+	}
+	if c.Limits.MaxRecordBytes <= 0 {
+		return fmt.Errorf("max record bytes must be positive, got %d", c.Limits.MaxRecordBytes)
+	}
+
+	if _, ok := logLevels[c.Log.Level]; !ok {
+		return fmt.Errorf("unknown log level %q", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("unknown log format %q", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			return errors.New("the file trace exporter requires a trace file")
+		}
+	default:
+		return fmt.Errorf("unknown trace exporter %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("trace sample ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	return nil
+}
+
+func (c Config) syncPolicy() tl.SyncPolicy {
+	return tl.SyncPolicy{Mode: syncModes[c.Logger.Sync], Interval: c.Logger.SyncInterval}
+}
+
+func (c Config) logPath() string {
+	if c.Logger.Path != "" {
+		return c.Logger.Path
+	}
+	return defaultLogPaths[c.Logger.Backend]
+}
+
+// newLogHandler is the handler of the server logs on stderr
+func newLogHandler(c LogConfig) slog.Handler {
+	opts := &slog.HandlerOptions{Level: logLevels[c.Level]}
+	if c.Format == "json" {
+		return slog.NewJSONHandler(os.Stderr, opts)
+	}
+	return slog.NewTextHandler(os.Stderr, opts)
+}
+
+// newAuth loads the authenticators and the acl, nil if auth is disabled
+func newAuth(c Config) (*api.Auth, error) {
+	if !c.Auth.enabled(c.TLS) {
+		return nil, nil
+	}
+
+	auth := &api.Auth{}
+	if c.Auth.TokensFile != "" {
+		tokens, err := api.LoadStaticTokens(c.Auth.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators, tokens)
+	}
+	if c.Auth.JWKSFile != "" {
+		keys, err := api.LoadJWKS(c.Auth.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators,
+			&api.JWTVerifier{Keys: keys, Issuer: c.Auth.JWTIssuer, Audience: c.Auth.JWTAudience})
+	}
+	if c.Auth.ACLFile != "" {
+		policy, err := api.LoadPolicy(c.Auth.ACLFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.Policy = policy
+	}
+	return auth, nil
+}
+
+// newLogger opens the configured logger
+func newLogger(c Config) (tl.TransactionLogger, error) {
+	switch c.Logger.Backend {
+	case "proto":
+		return tl.NewProtoTransactionLoggerWithParams(c.logPath(), tl.ProtoLoggerParams{
+			MaxSegmentBytes: c.Logger.MaxSegmentBytes,
+			MaxRecordBytes:  c.Limits.MaxRecordBytes,
+			Sync:            c.syncPolicy(),
+		})
+	case "file":
+		return tl.NewFileTransactionLoggerWithParams(c.logPath(), tl.FileLoggerParams{
+			MaxRecordBytes: c.Limits.MaxRecordBytes,
+			Sync:           c.syncPolicy(),
+		})
+	case "sqlite":
+		return tl.NewSQLiteTransactionLogger(c.logPath())
+	case "postgres":
+		return tl.NewPostgresTransactionLogger(tl.PostgresDBParams{
+			Host:     c.Postgres.Host,
+			DBName:   c.Postgres.DBName,
+			User:     c.Postgres.User,
+			Password: c.Postgres.Password,
+			SSLMode:  c.Postgres.SSLMode,
+		})
+	default:
+		return nil, fmt.Errorf("unknown logger backend %q", c.Logger.Backend)
+	}
+}
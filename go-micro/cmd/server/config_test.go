@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFile writes the yaml to a config file of the test and returns its path
+func writeConfigFile(t *testing.T, yaml string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(yaml), 0644))
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := "listen: \":9000\"\nlogger:\n  sync: none\nlimits:\n  max_record_bytes: 1024\n"
+	other := "listen: \":9500\"\n"
+
+	tests := []struct {
+		name           string
+		file           string // passed with -config unless empty
+		envFile        string // passed with KV_CONFIG unless empty
+		env            map[string]string
+		args           []string
+		listen         string
+		sync           string
+		maxRecordBytes int
+	}{
+		{
+			name:   "defaults",
+			listen: ":8080", sync: "always", maxRecordBytes: defaultConfig().Limits.MaxRecordBytes,
+		}, {
+			name:   "file over defaults",
+			file:   file,
+			listen: ":9000", sync: "none", maxRecordBytes: 1024,
+		}, {
+			name:   "environment over file",
+			file:   file,
+			env:    map[string]string{"KV_LISTEN": ":9100", "KV_SYNC": "interval"},
+			listen: ":9100", sync: "interval", maxRecordBytes: 1024,
+		}, {
+			name:   "flags over environment",
+			file:   file,
+			env:    map[string]string{"KV_LISTEN": ":9100", "KV_SYNC": "interval"},
+			args:   []string{"-listen", ":9200"},
+			listen: ":9200", sync: "interval", maxRecordBytes: 1024,
+		}, {
+			name:   "flags set to their default still win",
+			env:    map[string]string{"KV_SYNC": "none"},
+			args:   []string{"-sync", "always"},
+			listen: ":8080", sync: "always", maxRecordBytes: defaultConfig().Limits.MaxRecordBytes,
+		}, {
+			name:    "file of the environment",
+			envFile: file,
+			listen:  ":9000", sync: "none", maxRecordBytes: 1024,
+		}, {
+			name:    "file of the flag over the one of the environment",
+			file:    other,
+			envFile: file,
+			listen:  ":9500", sync: "always", maxRecordBytes: defaultConfig().Limits.MaxRecordBytes,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env := make(map[string]string)
+			for k, v := range tc.env {
+				env[k] = v
+			}
+			if tc.envFile != "" {
+				env["KV_CONFIG"] = writeConfigFile(t, tc.envFile)
+			}
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, tc.file)}, args...)
+			}
+
+			cfg, err := loadConfig(args, func(name string) string { return env[name] })
+			assert.NoError(t, err)
+			assert.Equal(t, tc.listen, cfg.Listen)
+			assert.Equal(t, tc.sync, cfg.Logger.Sync)
+			assert.Equal(t, tc.maxRecordBytes, cfg.Limits.MaxRecordBytes)
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		err  string
+	}{
+		{name: "unknown flag", args: []string{"-no-such-flag"}, err: "not defined"},
+		{name: "arguments", args: []string{"extra"}, err: "unexpected arguments: extra"},
+		{name: "invalid environment value", env: map[string]string{"KV_MAX_RECORD_BYTES": "many"}, err: "invalid KV_MAX_RECORD_BYTES"},
+		{name: "unknown file key", file: "listen: \":9000\"\nport: 9000\n", err: "error parsing config file"},
+		{name: "missing file", args: []string{"-config", "/no/such/config.yaml"}, err: "error opening config file"},
+		{name: "listen", args: []string{"-listen", "8080"}, err: "listen"},
+		{name: "http listen", args: []string{"-http-listen", "8081"}, err: "http listen"},
+		{name: "shutdown timeout", args: []string{"-shutdown-timeout", "0s"}, err: "shutdown timeout must be positive"},
+		{name: "logger backend", args: []string{"-logger", "mysql"}, err: "unknown logger backend"},
+		{name: "sync mode", args: []string{"-sync", "sometimes"}, err: "unknown sync mode"},
+		{name: "sync interval", args: []string{"-sync", "interval", "-sync-interval", "0s"}, err: "sync interval must be positive"},
+		{name: "failure policy", args: []string{"-logger-failure", "ignore"}, err: "unknown logger failure policy"},
+		{name: "max segment bytes", args: []string{"-max-segment-bytes", "-1"}, err: "max segment bytes must not be negative"},
+		{name: "snapshot dir", args: []string{"-snapshot-dir", ""}, err: "snapshot dir must be set"},
+		{name: "snapshot interval", args: []string{"-snapshot-interval", "0s"}, err: "snapshot interval must be positive"},
+		{name: "tls cert without key", args: []string{"-tls-cert", "cert.pem"}, err: "tls cert and key must be set together"},
+		{name: "tls client ca without cert", args: []string{"-tls-client-ca", "ca.pem"}, err: "tls client ca requires a tls cert"},
+		{name: "acl without auth", args: []string{"-acl", "acl.yaml"}, err: "acl requires auth"},
+		{name: "jwt issuer without jwks", args: []string{"-auth-jwt-issuer", "https://issuer.example"}, err: "require a jwks"},
+		{name: "max record bytes", args: []string{"-max-record-bytes", "0"}, err: "max record bytes must be positive"},
+		{name: "log level", args: []string{"-log-level", "trace"}, err: "unknown log level"},
+		{name: "log format", args: []string{"-log-format", "xml"}, err: "unknown log format"},
+		{name: "trace exporter", args: []string{"-trace-exporter", "zipkin"}, err: "unknown trace exporter"},
+		{name: "trace file", args: []string{"-trace-exporter", "file"}, err: "requires a trace file"},
+		{name: "trace sample ratio", args: []string{"-trace-sample-ratio", "2"}, err: "trace sample ratio must be between 0 and 1"},
+		{name: "invalid value of the file", file: "logger:\n  backend: mysql\n", err: "unknown logger backend"},
+		{name: "invalid value of the environment", env: map[string]string{"KV_LOG_LEVEL": "trace"}, err: "unknown log level"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", writeConfigFile(t, tc.file)}, args...)
+			}
+
+			_, err := loadConfig(args, func(name string) string { return tc.env[name] })
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-micro/internal/api"
+	pb "go-micro/proto/store"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// gatewayBodyOverhead is what a json put body may take besides the value
+const gatewayBodyOverhead = 64 << 10
+
+// gateway serves the keys over http with the handlers of the grpc service,
+// so writes are checked and logged the same way
+//
+//	GET    /v1/keys/{key}
+//	PUT    /v1/keys/{key}?ttl=seconds   the body is the value, or a json
+//	                                    {"value": ..., "ttl": ...} object
+//	DELETE /v1/keys/{key}
+//
+// keys may contain slashes, responses are json, requests are authorized
+// like grpc calls with the bearer token of their authorization header
+type gateway struct {
+	store *api.StoreServer
+	auth  *api.Auth     // nil serves every client
+	audit *api.AuditLog // nil audits nothing
+}
+
+type keyResponse struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version uint64 `json:"version,omitempty"`
+}
+
+type putBody struct {
+	Value string `json:"value"`
+	TTL   int64  `json:"ttl"` // seconds, 0 never expires
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func newGateway(store *api.StoreServer, auth *api.Auth, audit *api.AuditLog) http.Handler {
+	g := &gateway{store: store, auth: auth, audit: audit}
+
+	// every route is logged and traced under its pattern,
+	// continuing the trace of the traceparent header
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, otelhttp.NewHandler(logRequests(handler), pattern))
+	}
+	handle("GET /v1/keys/{key...}", g.get)
+	handle("PUT /v1/keys/{key...}", g.put)
+	handle("DELETE /v1/keys/{key...}", g.del)
+	return mux
+}
+
+func (g *gateway) get(w http.ResponseWriter, r *http.Request) {
+	req := &pb.GetRequest{Key: r.PathValue("key")}
+	ctx, err := g.check(r, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res, err := g.store.GetHandler(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keyResponse{Key: req.GetKey(), Value: res.GetValue(), Version: res.GetVersion()})
+}
+
+func (g *gateway) put(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req, err := g.parsePut(w, r)
+	defer func() { g.record(r, pb.StoreService_PutHandler_FullMethodName, req, start, err) }()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ctx, err := g.check(r, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res, err := g.store.PutHandler(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keyResponse{Key: res.GetKey(), Value: res.GetValue(), Version: res.GetVersion()})
+}
+
+func (g *gateway) del(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := &pb.DelRequest{Key: r.PathValue("key")}
+	ctx, err := g.check(r, req)
+	defer func() { g.record(r, pb.StoreService_DelHandler_FullMethodName, req, start, err) }()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res, err := g.store.DelHandler(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keyResponse{Key: res.GetKey(), Value: res.GetValue(), Version: res.GetVersion()})
+}
+
+// check authorizes the request if auth is enabled, a client certificate
+// authenticates the request as it does a grpc call
+func (g *gateway) check(r *http.Request, req any) (context.Context, error) {
+	if g.auth == nil {
+		return r.Context(), nil
+	}
+
+	ctx := r.Context()
+	if r.TLS != nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *r.TLS}})
+	}
+	return g.auth.Check(ctx, r.Header.Get("Authorization"), req)
+}
+
+// record audits the call of the handler of the grpc method
+func (g *gateway) record(r *http.Request, method string, req any, start time.Time, err error) {
+	if auditErr := g.audit.Record(r.Context(), "http", method, req, start, err); auditErr != nil {
+		slog.ErrorContext(r.Context(), "error auditing call", "method", method, "err", auditErr)
+	}
+}
+
+// parsePut reads the put from the body, bodies above the maximum record size are
+// refused before they are read in full, the request holds at least the key
+func (g *gateway) parsePut(w http.ResponseWriter, r *http.Request) (*pb.PutRequest, error) {
+	req := &pb.PutRequest{Key: r.PathValue("key")}
+
+	body := r.Body
+	if g.store.MaxRecordBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, int64(g.store.MaxRecordBytes)+gatewayBodyOverhead)
+	}
+	data, err := io.ReadAll(body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return req, status.Errorf(codes.ResourceExhausted, "body exceeds %d bytes", tooLarge.Limit)
+	}
+	if err != nil {
+		return req, status.Errorf(codes.InvalidArgument, "error reading body: %s", err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var put putBody
+		if err := json.Unmarshal(data, &put); err != nil {
+			return req, status.Errorf(codes.InvalidArgument, "invalid json body: %s", err)
+		}
+		req.Value = put.Value
+		req.Ttl = put.TTL
+	} else {
+		req.Value = string(data)
+	}
+
+	if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+		seconds, err := strconv.ParseInt(ttl, 10, 64)
+		if err != nil {
+			return req, status.Errorf(codes.InvalidArgument, "invalid ttl %q", ttl)
+		}
+		req.Ttl = seconds
+	}
+
+	return req, nil
+}
+
+// httpStatus maps the grpc codes the handlers return onto http statuses
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.NotFound:           http.StatusNotFound,
+	codes.FailedPrecondition: http.StatusPreconditionFailed,
+	codes.ResourceExhausted:  http.StatusRequestEntityTooLarge,
+	codes.Canceled:           499, // client closed the request, as nginx has it
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	code, ok := httpStatus[st.Code()]
+	if !ok {
+		code = http.StatusInternalServerError
+	}
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeJSON(w, code, errorResponse{Error: st.Message()})
+}
+
+// statusRecorder remembers the status written for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// logRequests logs every request once it is served, with its
+// principal if it was authenticated
+func logRequests(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, call := api.WithCallInfo(r.Context())
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		handler(recorder, r.WithContext(ctx))
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if call.Principal != "" {
+			attrs = append(attrs, slog.String("principal", call.Principal))
+		}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", span.TraceID().String()))
+		}
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx, level, "http request", attrs...)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("error encoding response", "err", err)
+		http.Error(w, fmt.Sprintf("error encoding response: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-micro/internal/api"
+	"go-micro/internal/store"
+	tl "go-micro/internal/transationLogger"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// readOnlyLogger refuses every write as a supervised logger which failed
+type readOnlyLogger struct {
+	tl.TransactionLogger
+}
+
+func (readOnlyLogger) Writable() error { return tl.ErrReadOnly }
+
+func newTestLogger(t *testing.T) tl.TransactionLogger {
+	logger, err := tl.NewFileTransactionLoggerWithParams(filepath.Join(t.TempDir(), "transaction.txt"),
+		tl.FileLoggerParams{Sync: tl.SyncPolicy{Mode: tl.SyncNone}})
+	assert.NoError(t, err)
+	assert.NoError(t, tl.InitalizeTrasactionLogger(logger, store.NewKVStore(), nil))
+	t.Cleanup(func() { logger.Close(context.Background()) })
+	return logger
+}
+
+func TestGatewayStatus(t *testing.T) {
+	auth := &api.Auth{
+		Authenticators: []api.Authenticator{api.StaticTokens{"secret": "alice"}},
+		Policy: &api.Policy{Rules: []api.Rule{
+			{Principals: []string{"alice"}, Prefixes: []string{"a"}, Operations: []api.Operation{api.OpRead, api.OpWrite}},
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		contentType   string
+		authorization string
+		auth          *api.Auth
+		readOnly      bool
+		status        int
+		response      string // contained in the body
+	}{
+		{name: "get", method: http.MethodGet, path: "/v1/keys/a", status: http.StatusOK, response: `"value":"1"`},
+		{name: "get of a missing key", method: http.MethodGet, path: "/v1/keys/missing", status: http.StatusNotFound},
+		{name: "put", method: http.MethodPut, path: "/v1/keys/b?ttl=60", body: "2", status: http.StatusOK, response: `"version":2`},
+		{
+			name: "put of a json body", method: http.MethodPut, path: "/v1/keys/b",
+			body: `{"value": "2", "ttl": 60}`, contentType: "application/json", status: http.StatusOK,
+		},
+		{name: "invalid json", method: http.MethodPut, path: "/v1/keys/b", body: "{", contentType: "application/json", status: http.StatusBadRequest},
+		{name: "invalid ttl", method: http.MethodPut, path: "/v1/keys/b?ttl=soon", body: "2", status: http.StatusBadRequest},
+		{name: "negative ttl", method: http.MethodPut, path: "/v1/keys/b?ttl=-1", body: "2", status: http.StatusBadRequest},
+		{name: "value above the maximum record", method: http.MethodPut, path: "/v1/keys/b", body: strings.Repeat("x", 2048), status: http.StatusBadRequest},
+		{name: "body above the limit", method: http.MethodPut, path: "/v1/keys/b", body: strings.Repeat("x", 128<<10), status: http.StatusRequestEntityTooLarge},
+		{name: "delete", method: http.MethodDelete, path: "/v1/keys/a", status: http.StatusOK},
+		{name: "delete of a missing key", method: http.MethodDelete, path: "/v1/keys/missing", status: http.StatusNotFound},
+		{name: "read only log", method: http.MethodPut, path: "/v1/keys/b", body: "2", readOnly: true, status: http.StatusServiceUnavailable},
+		{name: "unauthenticated", method: http.MethodGet, path: "/v1/keys/a", auth: auth, status: http.StatusUnauthorized},
+		{name: "authorized", method: http.MethodGet, path: "/v1/keys/a", authorization: "Bearer secret", auth: auth, status: http.StatusOK},
+		{name: "forbidden", method: http.MethodDelete, path: "/v1/keys/a", authorization: "Bearer secret", auth: auth, status: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kvstore := store.NewKVStore()
+			kvstore.Put("a", "1")
+			logger := newTestLogger(t)
+			if tc.readOnly {
+				logger = readOnlyLogger{logger}
+			}
+			storeServer := &api.StoreServer{KVStore: kvstore, Logger: logger, MaxRecordBytes: 1024}
+			handler := newGateway(storeServer, tc.auth, nil)
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code, rec.Body.String())
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Body.String(), tc.response)
+			if tc.status == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{err: status.Error(codes.InvalidArgument, "bad"), status: http.StatusBadRequest},
+		{err: status.Error(codes.Unauthenticated, "who"), status: http.StatusUnauthorized},
+		{err: status.Error(codes.PermissionDenied, "no"), status: http.StatusForbidden},
+		{err: status.Error(codes.NotFound, "gone"), status: http.StatusNotFound},
+		{err: status.Error(codes.FailedPrecondition, "version"), status: http.StatusPreconditionFailed},
+		{err: status.Error(codes.ResourceExhausted, "large"), status: http.StatusRequestEntityTooLarge},
+		{err: status.Error(codes.Canceled, "canceled"), status: 499},
+		{err: status.Error(codes.DeadlineExceeded, "late"), status: http.StatusGatewayTimeout},
+		{err: status.Error(codes.Unavailable, "replaying"), status: http.StatusServiceUnavailable},
+		{err: status.Error(codes.Internal, "disk"), status: http.StatusInternalServerError},
+		{err: status.Error(codes.Aborted, "unmapped"), status: http.StatusInternalServerError},
+		{err: errors.New("plain"), status: http.StatusInternalServerError},
+	}
+
+	for _, tc := range tests {
+		t.Run(status.Code(tc.err).String(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, tc.err)
+			assert.Equal(t, tc.status, rec.Code)
+
+			var body errorResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, status.Convert(tc.err).Message(), body.Error)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "go-micro/proto/store"
+	"net/http"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errReplaying    = errors.New("replaying the transaction log")
+	errShuttingDown = errors.New("shutting down")
+)
+
+// readiness is what the grpc health service and the /readyz endpoint report,
+// the store is served once the log is replayed, and reported as not serving
+// while the logger refuses writes or the server shuts down
+type readiness struct {
+	health *health.Server
+
+	mu       sync.Mutex
+	replayed bool
+	failure  error // why the logger refuses writes
+	stopping bool
+}
+
+func newReadiness() *readiness {
+	r := &readiness{health: health.NewServer()}
+	r.update()
+	return r
+}
+
+// setReplayed lets the calls to the store through
+func (r *readiness) setReplayed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replayed = true
+	r.update()
+}
+
+// setFailed reports the store as not serving while err is not nil,
+// the server stays alive for the calls which only read
+func (r *readiness) setFailed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failure = err
+	r.update()
+}
+
+// shutdown reports every service as not serving until the server is stopped
+func (r *readiness) shutdown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopping = true
+	r.health.Shutdown()
+}
+
+// update sets the status of the health service, the empty
+// service is the server as a whole, r.mu must be held
+func (r *readiness) update() {
+	if r.stopping {
+		return
+	}
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if r.notReady() == nil {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	r.health.SetServingStatus("", status)
+	r.health.SetServingStatus(pb.StoreService_ServiceDesc.ServiceName, status)
+}
+
+// notReady tells why the server should get no traffic, r.mu must be held
+func (r *readiness) notReady() error {
+	switch {
+	case r.stopping:
+		return errShuttingDown
+	case !r.replayed:
+		return errReplaying
+	case r.failure != nil:
+		return r.failure
+	default:
+		return nil
+	}
+}
+
+func (r *readiness) ready() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.notReady()
+}
+
+// replaying refuses the calls to the store until the log is replayed,
+// the store would answer them from the part replayed so far
+func (r *readiness) replaying() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.replayed {
+		return status.Error(codes.Unavailable, errReplaying.Error())
+	}
+	return nil
+}
+
+func isStoreMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+pb.StoreService_ServiceDesc.ServiceName+"/")
+}
+
+func (r *readiness) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if isStoreMethod(info.FullMethod) {
+		if err := r.replaying(); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+func (r *readiness) streamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if isStoreMethod(info.FullMethod) {
+		if err := r.replaying(); err != nil {
+			return err
+		}
+	}
+	return handler(srv, stream)
+}
+
+// gate refuses the requests of the gateway until the log is replayed
+func (r *readiness) gate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := r.replaying(); err != nil {
+			writeError(w, err)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// serveHealthz answers the liveness probes, the server is alive as long as it
+// answers, a failed logger stops it under the stop policy and is kept
+// alive to serve reads under the others
+func (r *readiness) serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, nil)
+}
+
+// serveReadyz answers the readiness probes
+func (r *readiness) serveReadyz(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, r.ready())
+}
+
+func writeHealth(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, healthResponse{Status: "NOT_SERVING", Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, healthResponse{Status: "SERVING"})
+}
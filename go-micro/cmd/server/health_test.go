@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "go-micro/proto/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadiness(t *testing.T) {
+	r := newReadiness()
+	failure := errors.New("transaction log is read only")
+
+	// the steps run in order, each one changing the state of r
+	tests := []struct {
+		name   string
+		change func()
+		gated  bool // calls to the store are refused
+		ready  string
+	}{
+		{name: "replaying", change: func() {}, gated: true, ready: errReplaying.Error()},
+		{name: "replayed", change: r.setReplayed},
+		{name: "logger failed", change: func() { r.setFailed(failure) }, ready: failure.Error()},
+		{name: "logger recovered", change: func() { r.setFailed(nil) }},
+		{name: "shutting down", change: r.shutdown, ready: errShuttingDown.Error()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.change()
+
+			// the store methods wait for the replay, the other services never do
+			handler := func(ctx context.Context, req any) (any, error) { return "called", nil }
+			storeInfo := &grpc.UnaryServerInfo{FullMethod: pb.StoreService_GetHandler_FullMethodName}
+			res, err := r.unaryInterceptor(context.Background(), nil, storeInfo, handler)
+			healthInfo := &grpc.UnaryServerInfo{FullMethod: healthpb.Health_Check_FullMethodName}
+			_, healthErr := r.unaryInterceptor(context.Background(), nil, healthInfo, handler)
+			assert.NoError(t, healthErr)
+
+			streamInfo := &grpc.StreamServerInfo{FullMethod: pb.StoreService_Watch_FullMethodName}
+			streamErr := r.streamInterceptor(nil, nil, streamInfo, func(any, grpc.ServerStream) error { return nil })
+
+			rec := httptest.NewRecorder()
+			r.gate(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/keys/a", nil))
+
+			if tc.gated {
+				assert.Equal(t, codes.Unavailable, status.Code(err))
+				assert.Equal(t, codes.Unavailable, status.Code(streamErr))
+				assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "called", res)
+				assert.NoError(t, streamErr)
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+			}
+
+			// the probes and the health service report whether to send traffic
+			rec = httptest.NewRecorder()
+			r.serveReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			check, err := r.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: pb.StoreService_ServiceDesc.ServiceName})
+			assert.NoError(t, err)
+			if tc.ready == "" {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check.GetStatus())
+			} else {
+				assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+				assert.Contains(t, rec.Body.String(), tc.ready)
+				assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check.GetStatus())
+			}
+
+			rec = httptest.NewRecorder()
+			r.serveHealthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+		})
+	}
+}
@@ -1,22 +1,147 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"flag"
+	"go-micro/internal/api"
 	db "go-micro/internal/store"
 	tl "go-micro/internal/transationLogger"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func main() {
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("error loading configuration", err)
+	}
+	slog.SetDefault(slog.New(newLogHandler(cfg.Log)))
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("error setting up tracing", err)
+	}
+
+	// the runtime metrics are served besides the ones of the server
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	opts := ServerOptions{MaxRecordBytes: cfg.Limits.MaxRecordBytes, Metrics: registry}
+	if cfg.TLS.CertFile != "" {
+		opts.TLS, err = newTLSConfig(cfg.TLS)
+		if err != nil {
+			fatal("error loading the certificates", err)
+		}
+	}
+	opts.Auth, err = newAuth(cfg)
+	if err != nil {
+		fatal("error loading auth", err)
+	}
+	if cfg.Log.AuditFile != "" {
+		opts.Audit, err = api.OpenAuditLog(cfg.Log.AuditFile)
+		if err != nil {
+			fatal("error opening the audit log", err)
+		}
+	}
+
 	store := db.NewKVStore()
-	logger, err := tl.NewProtoTransactionLogger("./transaction.log")
+	logger, err := newLogger(cfg)
 	if err != nil {
-		log.Fatalln(err)
+		fatal("error opening the transaction log", err)
 	}
 
-	srv := NewServer(store, logger)
-	err = srv.ListenAndServe(8080)
+	snapshots, err := tl.NewSnapshotStore(cfg.Snapshots.Dir)
+	if err != nil {
+		fatal("error opening the snapshots", err)
+	}
+
+	opts.LoggerFailure = failurePolicies[cfg.Logger.Failure]
+	opts.ReopenLogger = func() (tl.TransactionLogger, error) {
+		return newLogger(cfg)
+	}
+	srv, err := NewServer(store, logger, snapshots, opts)
 	if err != nil {
-		fmt.Println("error while running the server: %s", err)
+		fatal("error creating the server", err)
 	}
+	// the snapshotter goes through the supervisor too
+	logger = srv.Logger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// the servers listen while the log is replayed, so the health
+	// service tells the orchestrator the store is not served yet
+	serveErr := make(chan error, 2)
+	slog.Info("serving grpc", "addr", cfg.Listen, "tls", cfg.TLS.CertFile != "", "auth", opts.Auth != nil)
+	go func() {
+		serveErr <- srv.ListenAndServe(cfg.Listen)
+	}()
+	if cfg.HTTPListen != "" {
+		slog.Info("serving http", "addr", cfg.HTTPListen, "tls", cfg.TLS.CertFile != "")
+		go func() {
+			if err := srv.ListenAndServeHTTP(cfg.HTTPListen); err != nil {
+				serveErr <- err
+			}
+		}()
+	}
+
+	if err := srv.Replay(); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+		fatal("error replaying the transaction log", err)
+	}
+
+	// snapshot the store so the log only holds the recent events
+	stopSnapshotter := tl.StartSnapshotter(logger, store, snapshots, cfg.Snapshots.Interval)
+
+	// log reaped keys so expirations survive a restart
+	stopReaper := srv.StartReaper(time.Second)
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			slog.Error("error while running the server", "err", err)
+		}
+	case err := <-srv.Failed():
+		slog.Error("stopping as the transaction log cannot be written", "err", err)
+		exitCode = 1
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	}
+
+	stopReaper()
+	stopSnapshotter()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("error shutting down", "err", err)
+	}
+
+	// the spans of the last requests are exported even if they used up the deadline
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), closeGrace)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("error shutting down tracing", "err", err)
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
+
+// fatal logs the error the server cannot start with and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
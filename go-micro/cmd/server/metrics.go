@@ -0,0 +1,63 @@
+package main
+
+import (
+	"go-micro/internal/api"
+	db "go-micro/internal/store"
+	tl "go-micro/internal/transationLogger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsStore is a store which knows its size, like the KVStore
+type statsStore interface {
+	Stats() (keys int, bytes int64)
+}
+
+// registerMetrics exports the size of the store, the state of the logger
+// and the metrics of the calls and the writer
+func registerMetrics(registerer prometheus.Registerer, s db.Store, logger tl.TransactionLogger) {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "kv",
+			Subsystem: "logger",
+			Name:      "queue_depth",
+			Help:      "Events queued for the writer of the transaction logger.",
+		}, func() float64 {
+			return float64(logger.QueueDepth())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "kv",
+			Subsystem: "logger",
+			Name:      "last_event_id",
+			Help:      "Id of the last event written to the transaction log.",
+		}, func() float64 {
+			return float64(logger.GetLastEventId())
+		}),
+	}
+
+	if stats, ok := s.(statsStore); ok {
+		collectors = append(collectors,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: "kv",
+				Subsystem: "store",
+				Name:      "keys",
+				Help:      "Keys in the store, including expired ones not reaped yet.",
+			}, func() float64 {
+				keys, _ := stats.Stats()
+				return float64(keys)
+			}),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: "kv",
+				Subsystem: "store",
+				Name:      "bytes",
+				Help:      "Approximate size of the store, the sum of its key and value lengths.",
+			}, func() float64 {
+				_, bytes := stats.Stats()
+				return float64(bytes)
+			}))
+	}
+
+	collectors = append(collectors, api.Collectors()...)
+	collectors = append(collectors, tl.Collectors()...)
+	registerer.MustRegister(collectors...)
+}
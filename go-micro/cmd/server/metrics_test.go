@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	pb "go-micro/proto/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestServerMetrics(t *testing.T) {
+	// each server registers with its own registry
+	other, _, _ := startTestServer(t, ServerOptions{})
+	defer other.Shutdown(context.Background())
+	registry := prometheus.NewRegistry()
+	srv, addr, _ := startTestServer(t, ServerOptions{Metrics: registry})
+	defer srv.Shutdown(context.Background())
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewStoreServiceClient(conn)
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := client.PutHandler(ctx, &pb.PutRequest{Key: key, Value: "value"})
+		assert.NoError(t, err)
+	}
+	_, err = client.GetHandler(ctx, &pb.GetRequest{Key: "missing"})
+	assert.Error(t, err)
+
+	rec := httptest.NewRecorder()
+	srv.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	for _, line := range []string{
+		"kv_store_keys 3\n",
+		"kv_store_bytes 18\n",
+		"kv_logger_last_event_id 3\n",
+		"kv_logger_queue_depth 0\n",
+		`kv_grpc_request_seconds_count{code="OK",method="/store.StoreService/PutHandler"}`,
+		`kv_grpc_request_seconds_count{code="NotFound",method="/store.StoreService/GetHandler"}`,
+		`kv_logger_write_seconds_count{backend="file"}`,
+		"kv_logger_replayed_events 0\n",
+	} {
+		assert.Contains(t, rec.Body.String(), line)
+	}
+
+	// the registry /metrics serves holds the metrics of the server
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, families)
+}
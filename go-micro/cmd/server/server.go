@@ -1,51 +1,234 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"go-micro/internal/api"
 	db "go-micro/internal/store"
 	tl "go-micro/internal/transationLogger"
 	pb "go-micro/proto/store"
-	"log"
+	"log/slog"
 	"net"
-	"strconv"
+	"net/http"
+	"slices"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
+// closeGrace is the time the logger gets to write the queued events
+// when the requests used up the shutdown deadline
+const closeGrace = 5 * time.Second
+
 type Server struct {
-	s      db.Store
-	logger tl.TransactionLogger
+	s           db.Store
+	storeServer *api.StoreServer
+	logger      *tl.Supervisor
+	snapshots   *tl.SnapshotStore
+	grpcServer  *grpc.Server
+	httpServer  *http.Server  // rest gateway to the handlers of grpcServer
+	audit       *api.AuditLog // closed once the requests stopped
+	readiness   *readiness
+}
+
+// ServerOptions are the options of the grpc server and the gateway
+type ServerOptions struct {
+	MaxRecordBytes int                  // writes above it are refused, 0 disables the check
+	Auth           *api.Auth            // nil serves every client
+	Audit          *api.AuditLog        // nil audits nothing
+	TLS            *tls.Config          // serves grpc and the gateway over tls, nil serves both in plaintext
+	Metrics        *prometheus.Registry // served on /metrics, nil serves the metrics of the server only
+	GRPC           []grpc.ServerOption
+
+	LoggerFailure tl.FailurePolicy                     // what is done once the logger fails
+	ReopenLogger  func() (tl.TransactionLogger, error) // opens the log again for the retry policy
 }
 
-func NewServer(s db.Store, logger tl.TransactionLogger) *Server {
-	err := tl.InitalizeTrasactionLogger(logger, s)
+// NewServer creates the grpc server and the gateway, they refuse the calls
+// to the store until Replay replayed the log into it, the logger is
+// supervised so its failure is handled by the failure policy
+func NewServer(s db.Store, logger tl.TransactionLogger, snapshots *tl.SnapshotStore, opts ServerOptions) (*Server, error) {
+	readiness := newReadiness()
+	supervisor, err := tl.NewSupervisor(logger, tl.SupervisorParams{
+		Policy:   opts.LoggerFailure,
+		Reopen:   opts.ReopenLogger,
+		Store:    s,
+		OnChange: readiness.setFailed,
+	})
 	if err != nil {
-		log.Fatalf("error initalizting logger: %s", err)
+		return nil, err
+	}
+	logger = supervisor
+
+	// the metrics, logging and audit interceptors come first to see the calls
+	// auth rejects, the stats handler traces every call, continuing the trace
+	// of the client
+	grpcOpts := slices.Clone(opts.GRPC)
+	if opts.TLS != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(opts.TLS)))
+	}
+	grpcOpts = append(grpcOpts,
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(api.UnaryMetricsInterceptor, api.UnaryLoggingInterceptor, readiness.unaryInterceptor),
+		grpc.ChainStreamInterceptor(api.StreamMetricsInterceptor, api.StreamLoggingInterceptor, readiness.streamInterceptor))
+	if opts.Audit != nil {
+		grpcOpts = append(grpcOpts, grpc.ChainUnaryInterceptor(opts.Audit.UnaryInterceptor))
+	}
+	if opts.Auth != nil {
+		grpcOpts = append(grpcOpts,
+			grpc.ChainUnaryInterceptor(opts.Auth.UnaryInterceptor),
+			grpc.ChainStreamInterceptor(opts.Auth.StreamInterceptor))
+	}
+
+	storeServer := &api.StoreServer{KVStore: s, Logger: logger, MaxRecordBytes: opts.MaxRecordBytes}
+	grpcServer := grpc.NewServer(grpcOpts...)
+	pb.RegisterStoreServiceServer(grpcServer, storeServer)
+	healthpb.RegisterHealthServer(grpcServer, readiness.health)
+	reflection.Register(grpcServer)
+
+	registry := opts.Metrics
+	if registry == nil {
+		registry = prometheus.NewRegistry()
 	}
+	registerMetrics(registry, s, logger)
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /healthz", readiness.serveHealthz)
+	mux.HandleFunc("GET /readyz", readiness.serveReadyz)
+	mux.Handle("/", readiness.gate(newGateway(storeServer, opts.Auth, opts.Audit)))
 
 	return &Server{
-		s:      s,
-		logger: logger,
+		s:           s,
+		storeServer: storeServer,
+		logger:      supervisor,
+		snapshots:   snapshots,
+		grpcServer:  grpcServer,
+		httpServer: &http.Server{
+			Handler:           mux,
+			TLSConfig:         opts.TLS,
+			ReadHeaderTimeout: 10 * time.Second,
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		},
+		audit:     opts.Audit,
+		readiness: readiness,
+	}, nil
+}
+
+// Replay loads the snapshot and replays the log into the store, runs the
+// logger and reports the server as serving, the server is reported
+// as not serving while the logger refuses writes
+func (s *Server) Replay() error {
+	if err := tl.InitalizeTrasactionLogger(s.logger, s.s, s.snapshots); err != nil {
+		return fmt.Errorf("error initalizting logger: %s", err)
 	}
+	s.readiness.setReplayed()
+	return nil
 }
 
-func (s *Server) ListenAndServe(port int) error {
-	const addr = "0.0.0.0"
+// Logger is the supervised logger, the one to write to
+func (s *Server) Logger() tl.TransactionLogger {
+	return s.logger
+}
 
-	listener, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+// StartReaper removes the expired keys every interval and logs their expiry,
+// the returned function stops it
+func (s *Server) StartReaper(interval time.Duration) (stop func()) {
+	return s.storeServer.StartReaper(interval)
+}
+
+// Failed receives the failure of the logger under the stop policy
+func (s *Server) Failed() <-chan error {
+	return s.logger.Err()
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("starting the server: %s", err)
 	}
+	return s.Serve(listener)
+}
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterStoreServiceServer(grpcServer, &api.StoreServer{KVStore: s.s, Logger: s.logger})
-	reflection.Register(grpcServer)
-	err = grpcServer.Serve(listener)
+// Serve serves grpc on the listener until the server is shut down
+func (s *Server) Serve(listener net.Listener) error {
+	err := s.grpcServer.Serve(listener)
 	if err != nil {
 		return fmt.Errorf("error servering server: %s", err)
 	}
 
 	return nil
 }
+
+// ListenAndServeHTTP serves the rest gateway and the metrics, it returns nil
+// once the server is shut down
+func (s *Server) ListenAndServeHTTP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("starting the http server: %s", err)
+	}
+	return s.ServeHTTP(listener)
+}
+
+// ServeHTTP serves the rest gateway and the metrics on the listener,
+// over tls with the certificates of grpc if they are set
+func (s *Server) ServeHTTP(listener net.Listener) error {
+	var err error
+	if s.httpServer.TLSConfig != nil {
+		err = s.httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = s.httpServer.Serve(listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving http: %s", err)
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for the running ones until ctx
+// is done, cancelling the rest, then closes the logger once the writes are durable,
+// the watch streams never finish on their own so they are ended first
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.readiness.shutdown()
+	s.storeServer.StopWatches()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.httpServer.Close()
+	}
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		<-stopped
+	}
+
+	// the queued writes are flushed even if the requests took all the time
+	closeCtx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		closeCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), closeGrace)
+		defer cancel()
+	}
+
+	if err := s.audit.Close(); err != nil {
+		slog.Error("error closing audit log", "err", err)
+	}
+	if err := s.logger.Close(closeCtx); err != nil {
+		return fmt.Errorf("error closing logger: %s", err)
+	}
+	return nil
+}
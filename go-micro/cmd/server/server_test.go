@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"go-micro/internal/store"
+	tl "go-micro/internal/transationLogger"
+	pb "go-micro/proto/store"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// startTestServer serves a server with an empty store on free ports
+// and returns it with the addresses of grpc and http
+func startTestServer(t *testing.T, opts ServerOptions) (srv *Server, grpcAddr, httpAddr string) {
+	logger, err := tl.NewFileTransactionLoggerWithParams(filepath.Join(t.TempDir(), "transaction.txt"),
+		tl.FileLoggerParams{Sync: tl.SyncPolicy{Mode: tl.SyncNone}})
+	assert.NoError(t, err)
+	snapshots, err := tl.NewSnapshotStore(t.TempDir())
+	assert.NoError(t, err)
+
+	srv, err = NewServer(store.NewKVStore(), logger, snapshots, opts)
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go srv.Serve(listener)
+	httpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go srv.ServeHTTP(httpListener)
+	assert.NoError(t, srv.Replay())
+
+	return srv, listener.Addr().String(), httpListener.Addr().String()
+}
+
+func TestServerShutdownWithWatch(t *testing.T) {
+	srv, addr, _ := startTestServer(t, ServerOptions{})
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewStoreServiceClient(conn)
+
+	ctx := context.Background()
+	// replayed from the first event, as the watch may start after the put
+	stream, err := client.Watch(ctx, &pb.WatchRequest{Key: "a", FromEventId: 1})
+	assert.NoError(t, err)
+
+	// the watch is open once it received an event
+	_, err = client.PutHandler(ctx, &pb.PutRequest{Key: "a", Value: "1"})
+	assert.NoError(t, err)
+	res, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", res.GetValue())
+
+	// the open watch does not hold up the graceful stop
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.NoError(t, srv.Shutdown(shutdownCtx))
+	assert.NoError(t, shutdownCtx.Err())
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.ErrorContains(t, err, "resume from event 2")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// certCheckInterval bounds how often a handshake checks the files for changes
+const certCheckInterval = time.Second
+
+// certReloader serves the certificates of the files and reloads them once
+// they change, files which fail to load keep the previous certificates
+type certReloader struct {
+	files []string // cert, key and the optional client ca bundle
+
+	mu      sync.Mutex
+	checked time.Time
+	stamps  []fileStamp // of the files the config was loaded from
+	config  *tls.Config
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// newTLSConfig loads the certificates, requiring clients to present a
+// certificate signed by the bundle if a client ca file is set
+func newTLSConfig(c TLSConfig) (*tls.Config, error) {
+	r := &certReloader{files: []string{c.CertFile, c.KeyFile}}
+	if c.ClientCAFile != "" {
+		r.files = append(r.files, c.ClientCAFile)
+	}
+
+	stamps, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(stamps); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.getConfigForClient,
+	}, nil
+}
+
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < certCheckInterval {
+		return r.config, nil
+	}
+	r.checked = time.Now()
+
+	stamps, err := r.stat()
+	if err != nil {
+		slog.Warn("keeping the loaded certificates", "err", err)
+		return r.config, nil
+	}
+	if slices.Equal(stamps, r.stamps) {
+		return r.config, nil
+	}
+
+	// a cert and key written one after the other may not match for a moment,
+	// they are loaded again on the next handshake
+	if err := r.load(stamps); err != nil {
+		slog.Warn("keeping the loaded certificates", "err", err)
+		return r.config, nil
+	}
+	slog.Info("reloaded the certificates", "cert", r.files[0])
+	return r.config, nil
+}
+
+func (r *certReloader) stat() ([]fileStamp, error) {
+	stamps := make([]fileStamp, 0, len(r.files))
+	for _, file := range r.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading certificate: %s", err)
+		}
+		stamps = append(stamps, fileStamp{modTime: info.ModTime(), size: info.Size()})
+	}
+	return stamps, nil
+}
+
+func (r *certReloader) load(stamps []fileStamp) error {
+	cert, err := tls.LoadX509KeyPair(r.files[0], r.files[1])
+	if err != nil {
+		return fmt.Errorf("error loading certificate: %s", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"}, // grpc and the gateway
+	}
+
+	if len(r.files) > 2 {
+		pem, err := os.ReadFile(r.files[2])
+		if err != nil {
+			return fmt.Errorf("error loading client ca: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("error loading client ca: no certificates in " + r.files[2])
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.config = config
+	r.stamps = stamps
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"go-micro/internal/api"
+	pb "go-micro/proto/store"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// testCert is a certificate with its key, signed by the ca it was issued by
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert issues a certificate for the common name, a nil ca issues a ca
+func newTestCert(t *testing.T, cn string, ca *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	assert.NoError(t, err)
+	return cert
+}
+
+// writeTLSFiles writes the certificate and key files of the server
+// and the client ca bundle into dir
+func writeTLSFiles(t *testing.T, dir string, server, ca *testCert) TLSConfig {
+	c := TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	assert.NoError(t, os.WriteFile(c.CertFile, server.certPEM, 0600))
+	assert.NoError(t, os.WriteFile(c.KeyFile, server.keyPEM, 0600))
+	assert.NoError(t, os.WriteFile(c.ClientCAFile, ca.certPEM, 0600))
+	return c
+}
+
+// servedCert returns the certificate the config serves a handshake with
+func servedCert(t *testing.T, config *tls.Config) *x509.Certificate {
+	clientConfig, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	return clientConfig.Certificates[0].Leaf
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, 0)
+	first := newTestCert(t, "first", ca, x509.ExtKeyUsageServerAuth)
+	second := newTestCert(t, "second", ca, x509.ExtKeyUsageServerAuth)
+
+	c := writeTLSFiles(t, t.TempDir(), first, ca)
+	config, err := newTLSConfig(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", servedCert(t, config).Subject.CommonName)
+
+	// a key which does not match the certificate keeps the loaded one
+	assert.NoError(t, os.WriteFile(c.CertFile, second.certPEM, 0600))
+	time.Sleep(certCheckInterval)
+	assert.Equal(t, "first", servedCert(t, config).Subject.CommonName)
+
+	// the new certificate is served once its key is written as well
+	assert.NoError(t, os.WriteFile(c.KeyFile, second.keyPEM, 0600))
+	time.Sleep(certCheckInterval)
+	assert.Equal(t, "second", servedCert(t, config).Subject.CommonName)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, 0)
+	server := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	other := newTestCert(t, "other", ca, x509.ExtKeyUsageServerAuth)
+
+	tests := []struct {
+		name   string
+		change func(c TLSConfig)
+		err    string
+	}{
+		{
+			name: "key of another certificate",
+			change: func(c TLSConfig) {
+				os.WriteFile(c.KeyFile, other.keyPEM, 0600)
+			},
+			err: "error loading certificate",
+		},
+		{
+			name: "missing key",
+			change: func(c TLSConfig) {
+				os.Remove(c.KeyFile)
+			},
+			err: "error reading certificate",
+		},
+		{
+			name: "client ca without certificates",
+			change: func(c TLSConfig) {
+				os.WriteFile(c.ClientCAFile, []byte("not a certificate"), 0600)
+			},
+			err: "no certificates in",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := writeTLSFiles(t, t.TempDir(), server, ca)
+			tc.change(c)
+			_, err := newTLSConfig(c)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func TestServerMutualTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, 0)
+	server := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+
+	config, err := newTLSConfig(writeTLSFiles(t, t.TempDir(), server, ca))
+	assert.NoError(t, err)
+	// the client certificate authenticates the calls to grpc and the gateway
+	srv, grpcAddr, httpAddr := startTestServer(t, ServerOptions{TLS: config, Auth: &api.Auth{}})
+	defer srv.Shutdown(context.Background())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	withCert := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client.tlsCertificate(t)}}
+	withoutCert := &tls.Config{RootCAs: roots}
+
+	tests := []struct {
+		name   string
+		config *tls.Config
+		code   codes.Code
+		status int // of the gateway, 0 if the handshake fails
+	}{
+		{name: "client certificate", config: withCert, code: codes.OK, status: http.StatusNotFound},
+		{name: "no client certificate", config: withoutCert, code: codes.Unavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(credentials.NewTLS(tc.config)))
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err = pb.NewStoreServiceClient(conn).PutHandler(ctx, &pb.PutRequest{Key: "a", Value: "1"})
+			assert.Equal(t, tc.code, status.Code(err), err)
+
+			// the gateway is served with the same certificates
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tc.config}}
+			res, err := httpClient.Get("https://" + httpAddr + "/v1/keys/missing")
+			if tc.status == 0 {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			res.Body.Close()
+			assert.Equal(t, tc.status, res.StatusCode)
+		})
+	}
+
+	// plaintext is refused on both listeners
+	res, err := http.Get("http://" + httpAddr + "/metrics")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	pb "go-micro/proto/store"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Operation is what a request does to its keys
+type Operation string
+
+const (
+	OpRead   Operation = "read"   // get, scan and watch
+	OpWrite  Operation = "write"  // puts, conditional puts and the puts of a batch
+	OpDelete Operation = "delete" // deletes and the deletes of a batch
+)
+
+// Policy grants principals operations on the keys with a prefix,
+// whatever no rule grants is denied
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+type Rule struct {
+	Principals []string    `yaml:"principals"` // * matches every principal
+	Prefixes   []string    `yaml:"prefixes"`   // the empty prefix matches every key
+	Operations []Operation `yaml:"operations"`
+}
+
+// LoadPolicy reads a yaml policy, for example
+//
+//	rules:
+//	  - principals: [billing]
+//	    prefixes: [invoices/]
+//	    operations: [read, write, delete]
+//	  - principals: ["*"]
+//	    prefixes: [public/]
+//	    operations: [read]
+func LoadPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening acl: %s", err)
+	}
+	defer f.Close()
+
+	var policy Policy
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing acl %s: %s", path, err)
+	}
+
+	for i, rule := range policy.Rules {
+		if len(rule.Principals) == 0 {
+			return nil, fmt.Errorf("acl rule %d: no principals", i)
+		}
+		if len(rule.Prefixes) == 0 {
+			return nil, fmt.Errorf("acl rule %d: no prefixes, use \"\" for every key", i)
+		}
+		for _, op := range rule.Operations {
+			if op != OpRead && op != OpWrite && op != OpDelete {
+				return nil, fmt.Errorf("acl rule %d: unknown operation %q", i, op)
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+// Allowed tells if a rule grants the principal the operation on the key,
+// for a scan or a prefix watch the key is the prefix of the keys read
+func (p *Policy) Allowed(principal string, op Operation, key string) bool {
+	for _, rule := range p.Rules {
+		if !slices.Contains(rule.Operations, op) {
+			continue
+		}
+		if !slices.Contains(rule.Principals, principal) && !slices.Contains(rule.Principals, "*") {
+			continue
+		}
+		for _, prefix := range rule.Prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type access struct {
+	op  Operation
+	key string
+}
+
+// requestAccess lists what the request does to which keys
+func requestAccess(req any) []access {
+	switch req := req.(type) {
+	case *pb.GetRequest:
+		return []access{{OpRead, req.GetKey()}}
+	case *pb.ScanRequest:
+		return []access{{OpRead, req.GetPrefix()}}
+	case *pb.WatchRequest:
+		return []access{{OpRead, req.GetKey()}}
+	case *pb.PutRequest:
+		return []access{{OpWrite, req.GetKey()}}
+	case *pb.CompareAndSwapRequest:
+		return []access{{OpWrite, req.GetKey()}}
+	case *pb.PutIfAbsentRequest:
+		return []access{{OpWrite, req.GetKey()}}
+	case *pb.DelRequest:
+		return []access{{OpDelete, req.GetKey()}}
+	case *pb.DeleteIfVersionRequest:
+		return []access{{OpDelete, req.GetKey()}}
+	case *pb.BatchRequest:
+		accesses := make([]access, 0, len(req.GetOps()))
+		for _, op := range req.GetOps() {
+			if op.GetType() == pb.BatchOp_DELETE {
+				accesses = append(accesses, access{OpDelete, op.GetKey()})
+			} else {
+				accesses = append(accesses, access{OpWrite, op.GetKey()})
+			}
+		}
+		return accesses
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	pb "go-micro/proto/store"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var testPolicy = &Policy{Rules: []Rule{
+	{Principals: []string{"billing"}, Prefixes: []string{"invoices/", "customers/"}, Operations: []Operation{OpRead, OpWrite}},
+	{Principals: []string{"janitor"}, Prefixes: []string{""}, Operations: []Operation{OpDelete}},
+	{Principals: []string{"*"}, Prefixes: []string{"public/"}, Operations: []Operation{OpRead}},
+}}
+
+func TestPolicyAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal string
+		op        Operation
+		key       string
+		allowed   bool
+	}{
+		{name: "granted prefix", principal: "billing", op: OpWrite, key: "invoices/1", allowed: true},
+		{name: "second prefix of the rule", principal: "billing", op: OpRead, key: "customers/7", allowed: true},
+		{name: "prefix itself", principal: "billing", op: OpRead, key: "invoices/", allowed: true},
+		{name: "key without the prefix", principal: "billing", op: OpRead, key: "orders/1"},
+		{name: "prefix is not a substring", principal: "billing", op: OpRead, key: "old/invoices/1"},
+		{name: "key shorter than the prefix", principal: "billing", op: OpRead, key: "invoices"},
+		{name: "operation not granted", principal: "billing", op: OpDelete, key: "invoices/1"},
+		{name: "empty prefix matches every key", principal: "janitor", op: OpDelete, key: "anything", allowed: true},
+		{name: "empty prefix only for its operations", principal: "janitor", op: OpRead, key: "anything"},
+		{name: "wildcard principal", principal: "guest", op: OpRead, key: "public/readme", allowed: true},
+		{name: "wildcard principal only for its operations", principal: "guest", op: OpWrite, key: "public/readme"},
+		{name: "unknown principal", principal: "guest", op: OpRead, key: "invoices/1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.allowed, testPolicy.Allowed(tc.principal, tc.op, tc.key))
+		})
+	}
+}
+
+func TestAuthAuthorize(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *Policy
+		principal string
+		req       any
+		allowed   bool
+	}{
+		{name: "get", policy: testPolicy, principal: "billing", req: &pb.GetRequest{Key: "invoices/1"}, allowed: true},
+		{name: "get denied", policy: testPolicy, principal: "billing", req: &pb.GetRequest{Key: "orders/1"}},
+		{name: "scan of a granted prefix", policy: testPolicy, principal: "billing", req: &pb.ScanRequest{Prefix: "invoices/2024"}, allowed: true},
+		{name: "scan wider than the grant", policy: testPolicy, principal: "billing", req: &pb.ScanRequest{Prefix: "inv"}},
+		{name: "put", policy: testPolicy, principal: "billing", req: &pb.PutRequest{Key: "invoices/1"}, allowed: true},
+		{name: "compare and swap denied", policy: testPolicy, principal: "guest", req: &pb.CompareAndSwapRequest{Key: "public/readme"}},
+		{name: "put if absent", policy: testPolicy, principal: "billing", req: &pb.PutIfAbsentRequest{Key: "customers/1"}, allowed: true},
+		{name: "del", policy: testPolicy, principal: "janitor", req: &pb.DelRequest{Key: "invoices/1"}, allowed: true},
+		{name: "del denied", policy: testPolicy, principal: "billing", req: &pb.DelRequest{Key: "invoices/1"}},
+		{name: "delete if version denied", policy: testPolicy, principal: "billing", req: &pb.DeleteIfVersionRequest{Key: "invoices/1"}},
+		{
+			name: "batch of granted ops", policy: testPolicy, principal: "billing", allowed: true,
+			req: &pb.BatchRequest{Ops: []*pb.BatchOp{
+				{Type: pb.BatchOp_PUT, Key: "invoices/1"},
+				{Type: pb.BatchOp_PUT, Key: "customers/1"},
+			}},
+		}, {
+			name: "batch with a denied delete", policy: testPolicy, principal: "billing",
+			req: &pb.BatchRequest{Ops: []*pb.BatchOp{
+				{Type: pb.BatchOp_PUT, Key: "invoices/1"},
+				{Type: pb.BatchOp_DELETE, Key: "invoices/2"},
+			}},
+		}, {
+			name: "batch with a denied key", policy: testPolicy, principal: "billing",
+			req: &pb.BatchRequest{Ops: []*pb.BatchOp{
+				{Type: pb.BatchOp_PUT, Key: "invoices/1"},
+				{Type: pb.BatchOp_PUT, Key: "orders/1"},
+			}},
+		},
+		{name: "request without keys", policy: testPolicy, principal: "guest", req: &pb.BatchRequest{}, allowed: true},
+		{name: "no policy", principal: "guest", req: &pb.DelRequest{Key: "invoices/1"}, allowed: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := &Auth{Policy: tc.policy}
+			err := auth.Authorize(tc.principal, tc.req)
+			if tc.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, codes.PermissionDenied, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name  string
+		acl   string
+		rules int
+		err   string
+	}{
+		{
+			name:  "valid",
+			acl:   "rules:\n  - principals: [billing]\n    prefixes: [invoices/]\n    operations: [read, write, delete]\n",
+			rules: 1,
+		},
+		{name: "empty", acl: ""},
+		{
+			name: "no principals",
+			acl:  "rules:\n  - prefixes: [invoices/]\n    operations: [read]\n",
+			err:  "no principals",
+		}, {
+			name: "no prefixes",
+			acl:  "rules:\n  - principals: [billing]\n    operations: [read]\n",
+			err:  "no prefixes",
+		}, {
+			name: "unknown operation",
+			acl:  "rules:\n  - principals: [billing]\n    prefixes: [\"\"]\n    operations: [admin]\n",
+			err:  "unknown operation",
+		}, {
+			name: "unknown field",
+			acl:  "rules:\n  - principal: [billing]\n",
+			err:  "error parsing acl",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "acl.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(tc.acl), 0644))
+
+			policy, err := LoadPolicy(path)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, policy.Rules, tc.rules)
+		})
+	}
+}
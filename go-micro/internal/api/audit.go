@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// AuditRecord is a line of the audit log
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Transport string    `json:"transport"` // grpc or http
+	Method    string    `json:"method"`    // full grpc method, the gateway logs the one it calls
+	Principal string    `json:"principal,omitempty"`
+	Keys      []string  `json:"keys"`
+	Code      string    `json:"code"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+}
+
+// AuditLog appends a json record of every mutating call, including the
+// ones which are refused or fail, unlike the transaction log it records who
+// tried to write what rather than the writes, and is not replayed
+//
+// the records are written but not synced, a nil AuditLog records nothing
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens the audit log at path, appending to it if it exists
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %s", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Record appends the outcome of the request if it writes or deletes keys,
+// the principal is taken from the CallInfo or the principal of ctx
+func (a *AuditLog) Record(ctx context.Context, transport, method string, req any, start time.Time, err error) error {
+	if a == nil {
+		return nil
+	}
+
+	var keys []string
+	mutating := false
+	for _, access := range requestAccess(req) {
+		keys = append(keys, access.key)
+		mutating = mutating || access.op != OpRead
+	}
+	if !mutating {
+		return nil
+	}
+
+	record := AuditRecord{
+		Time:      start.UTC(),
+		Transport: transport,
+		Method:    method,
+		Keys:      keys,
+		Code:      status.Code(err).String(),
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if info, ok := ctx.Value(callInfoKey{}).(*CallInfo); ok {
+		record.Principal = info.Principal
+	}
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		record.Principal = principal
+	}
+	if err != nil {
+		record.Error = status.Convert(err).Message()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding audit record: %s", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing audit record: %s", err)
+	}
+	return nil
+}
+
+// UnaryInterceptor records the mutating calls, it has to wrap the
+// authentication to record the calls it refuses, the streams only read,
+// a record which cannot be written is logged as the write already happened
+func (a *AuditLog) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, _ = WithCallInfo(ctx)
+	start := time.Now()
+	res, err := handler(ctx, req)
+	if auditErr := a.Record(ctx, "grpc", info.FullMethod, req, start, err); auditErr != nil {
+		slog.ErrorContext(ctx, "error auditing call", "method", info.FullMethod, "err", auditErr)
+	}
+	return res, err
+}
+
+// Close closes the file of the log
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
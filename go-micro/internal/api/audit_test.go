@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	pb "go-micro/proto/store"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// secretValue is written by the requests and must never reach a log
+const secretValue = "s3cret-value"
+
+// stubHandler fails the requests of keys under fail/ as the store would
+func stubHandler(ctx context.Context, req any) (any, error) {
+	for _, access := range requestAccess(req) {
+		if strings.HasPrefix(access.key, "fail/") {
+			return nil, status.Error(codes.Internal, "error writing transaction log: disk full")
+		}
+	}
+	return &pb.PutResponse{}, nil
+}
+
+// readAuditRecords returns the records of the audit log at path
+func readAuditRecords(t *testing.T, path string) []AuditRecord {
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record AuditRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	assert.NoError(t, scanner.Err())
+	return records
+}
+
+func TestAuditLogUnaryInterceptor(t *testing.T) {
+	auth := &Auth{
+		Authenticators: []Authenticator{StaticTokens{"billing-token": "billing", "janitor-token": "janitor"}},
+		Policy: &Policy{Rules: []Rule{
+			{Principals: []string{"billing"}, Prefixes: []string{"invoices/", "fail/"}, Operations: []Operation{OpRead, OpWrite}},
+			{Principals: []string{"janitor"}, Prefixes: []string{""}, Operations: []Operation{OpDelete}},
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		req           any
+		record        *AuditRecord // nil if the call is not audited
+	}{
+		{
+			name:          "put",
+			method:        "/store.StoreService/PutHandler",
+			authorization: "Bearer billing-token",
+			req:           &pb.PutRequest{Key: "invoices/1", Value: secretValue},
+			record:        &AuditRecord{Principal: "billing", Keys: []string{"invoices/1"}, Code: "OK"},
+		}, {
+			name:          "compare and swap",
+			method:        "/store.StoreService/CompareAndSwap",
+			authorization: "Bearer billing-token",
+			req:           &pb.CompareAndSwapRequest{Key: "invoices/1", Value: secretValue, Version: 1},
+			record:        &AuditRecord{Principal: "billing", Keys: []string{"invoices/1"}, Code: "OK"},
+		}, {
+			name:          "delete",
+			method:        "/store.StoreService/DelHandler",
+			authorization: "Bearer janitor-token",
+			req:           &pb.DelRequest{Key: "invoices/1"},
+			record:        &AuditRecord{Principal: "janitor", Keys: []string{"invoices/1"}, Code: "OK"},
+		}, {
+			name:          "batch",
+			method:        "/store.StoreService/Batch",
+			authorization: "Bearer billing-token",
+			req: &pb.BatchRequest{Ops: []*pb.BatchOp{
+				{Key: "invoices/1", Value: secretValue},
+				{Key: "invoices/2", Value: secretValue},
+			}},
+			record: &AuditRecord{Principal: "billing", Keys: []string{"invoices/1", "invoices/2"}, Code: "OK"},
+		}, {
+			name:          "read is not audited",
+			method:        "/store.StoreService/GetHandler",
+			authorization: "Bearer billing-token",
+			req:           &pb.GetRequest{Key: "invoices/1"},
+		}, {
+			name:          "permission denied",
+			method:        "/store.StoreService/PutHandler",
+			authorization: "Bearer janitor-token",
+			req:           &pb.PutRequest{Key: "invoices/1", Value: secretValue},
+			record: &AuditRecord{Principal: "janitor", Keys: []string{"invoices/1"}, Code: "PermissionDenied",
+				Error: "janitor may not write key:invoices/1"},
+		}, {
+			name:   "unauthenticated",
+			method: "/store.StoreService/PutHandler",
+			req:    &pb.PutRequest{Key: "invoices/1", Value: secretValue},
+			record: &AuditRecord{Keys: []string{"invoices/1"}, Code: "Unauthenticated", Error: "missing bearer token"},
+		}, {
+			name:          "failed write",
+			method:        "/store.StoreService/PutHandler",
+			authorization: "Bearer billing-token",
+			req:           &pb.PutRequest{Key: "fail/1", Value: secretValue},
+			record: &AuditRecord{Principal: "billing", Keys: []string{"fail/1"}, Code: "Internal",
+				Error: "error writing transaction log: disk full"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			audit, err := OpenAuditLog(path)
+			assert.NoError(t, err)
+
+			// the audit wraps the authentication as in the server
+			info := &grpc.UnaryServerInfo{FullMethod: tc.method}
+			start := time.Now()
+			_, callErr := audit.UnaryInterceptor(metadataContext(tc.authorization), tc.req, info,
+				func(ctx context.Context, req any) (any, error) {
+					return auth.UnaryInterceptor(ctx, req, info, stubHandler)
+				})
+			assert.NoError(t, audit.Close())
+
+			records := readAuditRecords(t, path)
+			if tc.record == nil {
+				assert.Empty(t, records)
+				return
+			}
+			assert.Len(t, records, 1)
+			record := records[0]
+			assert.Equal(t, status.Code(callErr).String(), record.Code)
+			assert.Equal(t, "grpc", record.Transport)
+			assert.Equal(t, tc.method, record.Method)
+			assert.WithinDuration(t, start, record.Time, time.Second)
+
+			// the time and latency vary from run to run
+			record.Time, record.Transport, record.Method, record.LatencyMs = time.Time{}, "", "", 0
+			assert.Equal(t, *tc.record, record)
+
+			data, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(data), secretValue)
+		})
+	}
+}
+
+func TestAuditLogRecordNil(t *testing.T) {
+	var audit *AuditLog
+	err := audit.Record(context.Background(), "http", "/store.StoreService/PutHandler",
+		&pb.PutRequest{Key: "a", Value: secretValue}, time.Now(), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, audit.Close())
+}
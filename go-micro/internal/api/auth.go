@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUnknownToken is returned by an Authenticator which does not know the token
+var ErrUnknownToken = errors.New("unknown token")
+
+// Authenticator maps a bearer token to the principal it was issued to
+type Authenticator interface {
+	Authenticate(token string) (string, error)
+}
+
+// StaticTokens authenticates the tokens of a file
+type StaticTokens map[string]string // token to principal
+
+// LoadStaticTokens reads a file of "<token> <principal>" lines,
+// empty lines and lines starting with # are skipped
+func LoadStaticTokens(path string) (StaticTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening token file: %s", err)
+	}
+	defer f.Close()
+
+	tokens := make(StaticTokens)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a principal", path, line)
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading token file: %s", err)
+	}
+
+	return tokens, nil
+}
+
+func (t StaticTokens) Authenticate(token string) (string, error) {
+	principal, ok := t[token]
+	if !ok {
+		return "", ErrUnknownToken
+	}
+	return principal, nil
+}
+
+// jwtLeeway is the clock skew allowed when checking exp and nbf
+const jwtLeeway = time.Minute
+
+var jwtAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// JWTVerifier authenticates JWTs signed by a key of the set, the principal
+// is the subject, the issuer and audience are only checked if set
+type JWTVerifier struct {
+	Keys     jose.JSONWebKeySet
+	Issuer   string
+	Audience string
+}
+
+// LoadJWKS reads the key set of a JWTVerifier from a JWKS file
+func LoadJWKS(path string) (jose.JSONWebKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("error reading jwks: %s", err)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return jose.JSONWebKeySet{}, fmt.Errorf("error parsing jwks %s: %s", path, err)
+	}
+	if len(keys.Keys) == 0 {
+		return jose.JSONWebKeySet{}, fmt.Errorf("no keys in jwks %s", path)
+	}
+	return keys, nil
+}
+
+func (v *JWTVerifier) Authenticate(token string) (string, error) {
+	// anything but a compact JWS is left to the other authenticators
+	if strings.Count(token, ".") != 2 {
+		return "", ErrUnknownToken
+	}
+
+	parsed, err := jwt.ParseSigned(token, jwtAlgorithms)
+	if err != nil {
+		return "", fmt.Errorf("invalid jwt: %s", err)
+	}
+
+	var keys []jose.JSONWebKey
+	if kid := parsed.Headers[0].KeyID; kid != "" {
+		keys = v.Keys.Key(kid)
+	} else {
+		keys = v.Keys.Keys
+	}
+
+	for _, key := range keys {
+		var claims jwt.Claims
+		if err := parsed.Claims(key.Public(), &claims); err != nil {
+			continue
+		}
+
+		expected := jwt.Expected{Issuer: v.Issuer, Time: time.Now()}
+		if v.Audience != "" {
+			expected.AnyAudience = jwt.Audience{v.Audience}
+		}
+		if err := claims.ValidateWithLeeway(expected, jwtLeeway); err != nil {
+			return "", fmt.Errorf("invalid jwt: %s", err)
+		}
+		if claims.Subject == "" {
+			return "", errors.New("invalid jwt: no subject")
+		}
+		return claims.Subject, nil
+	}
+
+	return "", errors.New("invalid jwt: no key of the jwks verifies the signature")
+}
+
+// Auth authenticates the requests and authorizes them against the policy,
+// the principal of a request is the common name of its verified client
+// certificate or the principal of the bearer token in its authorization header
+type Auth struct {
+	Authenticators []Authenticator // asked in order for the principal of a token
+	Policy         *Policy         // nil allows every principal every operation
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal the request was authenticated as
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
+
+// contextWithPrincipal also hands the principal to the CallInfo
+// of the interceptors which wrap the authentication
+func contextWithPrincipal(ctx context.Context, principal string) context.Context {
+	if info, ok := ctx.Value(callInfoKey{}).(*CallInfo); ok {
+		info.Principal = principal
+	}
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Authenticate returns the principal of the request, authorization is the
+// value of its authorization header, empty if it sent none
+func (a *Auth) Authenticate(ctx context.Context, authorization string) (string, error) {
+	if id, ok := ClientIdentity(ctx); ok && id.CommonName != "" {
+		return id.CommonName, nil
+	}
+
+	if authorization == "" {
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization is not a bearer token")
+	}
+
+	for _, authenticator := range a.Authenticators {
+		principal, err := authenticator.Authenticate(token)
+		if errors.Is(err, ErrUnknownToken) {
+			continue
+		}
+		if err != nil {
+			return "", status.Error(codes.Unauthenticated, err.Error())
+		}
+		return principal, nil
+	}
+	return "", status.Error(codes.Unauthenticated, "unknown bearer token")
+}
+
+// Authorize checks the principal may run the request, requests which
+// touch no keys are allowed to every authenticated principal
+func (a *Auth) Authorize(principal string, req any) error {
+	if a.Policy == nil {
+		return nil
+	}
+
+	for _, access := range requestAccess(req) {
+		if !a.Policy.Allowed(principal, access.op, access.key) {
+			return status.Errorf(codes.PermissionDenied, "%s may not %s key:%s", principal, access.op, access.key)
+		}
+	}
+	return nil
+}
+
+// Check authenticates and authorizes the request, the returned context
+// carries the principal for PrincipalFromContext once it is authenticated
+func (a *Auth) Check(ctx context.Context, authorization string, req any) (context.Context, error) {
+	principal, err := a.Authenticate(ctx, authorization)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = contextWithPrincipal(ctx, principal)
+	if err := a.Authorize(principal, req); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+func incomingAuthorization(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// UnaryInterceptor authenticates and authorizes the unary calls
+func (a *Auth) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.Check(ctx, incomingAuthorization(ctx), req)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor authenticates the streaming calls and
+// authorizes every message the client sends on them
+func (a *Auth) StreamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	principal, err := a.Authenticate(stream.Context(), incomingAuthorization(stream.Context()))
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{
+		ServerStream: stream,
+		auth:         a,
+		principal:    principal,
+		ctx:          contextWithPrincipal(stream.Context(), principal),
+	})
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	auth      *Auth
+	principal string
+	ctx       context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.auth.Authorize(s.principal, m)
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	pb "go-micro/proto/store"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func newSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	return key
+}
+
+// signJWT signs the claims with the key, kid is left out of the header if empty
+func signJWT(t *testing.T, alg jose.SignatureAlgorithm, key any, kid string, claims jwt.Claims) string {
+	opts := (&jose.SignerOptions{}).WithType("JWT")
+	if kid != "" {
+		opts = opts.WithHeader("kid", kid)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: key}, opts)
+	assert.NoError(t, err)
+
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	assert.NoError(t, err)
+	return token
+}
+
+func TestJWTVerifier(t *testing.T) {
+	first, second, unknown := newSigningKey(t), newSigningKey(t), newSigningKey(t)
+	keys := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &first.PublicKey, KeyID: "first", Algorithm: string(jose.ES256)},
+		{Key: &second.PublicKey, KeyID: "second", Algorithm: string(jose.ES256)},
+	}}
+
+	now := time.Now()
+	valid := jwt.Claims{
+		Subject:  "alice",
+		Issuer:   "https://issuer.example",
+		Audience: jwt.Audience{"kv", "other"},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+	with := func(change func(c *jwt.Claims)) jwt.Claims {
+		c := valid
+		change(&c)
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		verifier JWTVerifier
+		token    string
+		err      string // empty if the token authenticates alice
+	}{
+		{
+			name:     "kid of the signing key",
+			verifier: JWTVerifier{Keys: keys},
+			token:    signJWT(t, jose.ES256, second, "second", valid),
+		}, {
+			name:     "without kid every key is tried",
+			verifier: JWTVerifier{Keys: keys},
+			token:    signJWT(t, jose.ES256, second, "", valid),
+		}, {
+			name:     "kid of another key",
+			verifier: JWTVerifier{Keys: keys},
+			token:    signJWT(t, jose.ES256, second, "first", valid),
+			err:      "no key of the jwks verifies the signature",
+		}, {
+			name:     "unknown kid",
+			verifier: JWTVerifier{Keys: keys},
+			token:    signJWT(t, jose.ES256, first, "third", valid),
+			err:      "no key of the jwks verifies the signature",
+		}, {
+			name:     "key outside the set",
+			verifier: JWTVerifier{Keys: keys},
+			token:    signJWT(t, jose.ES256, unknown, "", valid),
+			err:      "no key of the jwks verifies the signature",
+		}, {
+			name:     "hmac is not accepted",
+			verifier: JWTVerifier{Keys: keys},
+			token:    signJWT(t, jose.HS256, []byte("0123456789abcdef0123456789abcdef"), "", valid),
+			err:      "invalid jwt",
+		}, {
+			name:     "expired",
+			verifier: JWTVerifier{Keys: keys},
+			token: signJWT(t, jose.ES256, first, "first", with(func(c *jwt.Claims) {
+				c.Expiry = jwt.NewNumericDate(now.Add(-2 * jwtLeeway))
+			})),
+			err: "expired",
+		}, {
+			name:     "expired within the leeway",
+			verifier: JWTVerifier{Keys: keys},
+			token: signJWT(t, jose.ES256, first, "first", with(func(c *jwt.Claims) {
+				c.Expiry = jwt.NewNumericDate(now.Add(-jwtLeeway / 2))
+			})),
+		}, {
+			name:     "not valid yet",
+			verifier: JWTVerifier{Keys: keys},
+			token: signJWT(t, jose.ES256, first, "first", with(func(c *jwt.Claims) {
+				c.NotBefore = jwt.NewNumericDate(now.Add(2 * jwtLeeway))
+			})),
+			err: "not valid yet",
+		}, {
+			name:     "issuer",
+			verifier: JWTVerifier{Keys: keys, Issuer: "https://issuer.example"},
+			token:    signJWT(t, jose.ES256, first, "first", valid),
+		}, {
+			name:     "other issuer",
+			verifier: JWTVerifier{Keys: keys, Issuer: "https://other.example"},
+			token:    signJWT(t, jose.ES256, first, "first", valid),
+			err:      "issuer",
+		}, {
+			name:     "one of the audiences",
+			verifier: JWTVerifier{Keys: keys, Audience: "kv"},
+			token:    signJWT(t, jose.ES256, first, "first", valid),
+		}, {
+			name:     "other audience",
+			verifier: JWTVerifier{Keys: keys, Audience: "billing"},
+			token:    signJWT(t, jose.ES256, first, "first", valid),
+			err:      "audience",
+		}, {
+			name:     "no subject",
+			verifier: JWTVerifier{Keys: keys},
+			token: signJWT(t, jose.ES256, first, "first", with(func(c *jwt.Claims) {
+				c.Subject = ""
+			})),
+			err: "no subject",
+		}, {
+			name:     "tampered claims",
+			verifier: JWTVerifier{Keys: keys},
+			token: func() string {
+				// the claims of mallory under the signature of alice's token
+				token := strings.Split(signJWT(t, jose.ES256, first, "first", valid), ".")
+				other := strings.Split(signJWT(t, jose.ES256, first, "first", with(func(c *jwt.Claims) { c.Subject = "mallory" })), ".")
+				return strings.Join([]string{token[0], other[1], token[2]}, ".")
+			}(),
+			err: "no key of the jwks verifies the signature",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			principal, err := tc.verifier.Authenticate(tc.token)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				assert.NotErrorIs(t, err, ErrUnknownToken)
+				assert.Empty(t, principal)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", principal)
+		})
+	}
+
+	// opaque tokens are left to the other authenticators
+	_, err := (&JWTVerifier{Keys: keys}).Authenticate("opaque-token")
+	assert.ErrorIs(t, err, ErrUnknownToken)
+}
+
+// withClientCertificate returns a context of a request over mutual tls
+func withClientCertificate(ctx context.Context, commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestAuthAuthenticate(t *testing.T) {
+	key := newSigningKey(t)
+	jwtToken := signJWT(t, jose.ES256, key, "", jwt.Claims{Subject: "bob", Expiry: jwt.NewNumericDate(time.Now().Add(time.Hour))})
+	auth := &Auth{Authenticators: []Authenticator{
+		StaticTokens{"secret": "alice"},
+		&JWTVerifier{Keys: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey}}}},
+	}}
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		authorization string
+		principal     string // empty if the request is refused
+	}{
+		{name: "static token", ctx: context.Background(), authorization: "Bearer secret", principal: "alice"},
+		{name: "scheme in any case", ctx: context.Background(), authorization: "bearer secret", principal: "alice"},
+		{name: "jwt", ctx: context.Background(), authorization: "Bearer " + jwtToken, principal: "bob"},
+		{name: "client certificate", ctx: withClientCertificate(context.Background(), "carol"), principal: "carol"},
+		{name: "client certificate before the token", ctx: withClientCertificate(context.Background(), "carol"), authorization: "Bearer secret", principal: "carol"},
+		{name: "missing", ctx: context.Background()},
+		{name: "unknown token", ctx: context.Background(), authorization: "Bearer guess"},
+		{name: "other scheme", ctx: context.Background(), authorization: "Basic secret"},
+		{name: "empty token", ctx: context.Background(), authorization: "Bearer "},
+		{name: "invalid jwt", ctx: context.Background(), authorization: "Bearer " + jwtToken[:len(jwtToken)-4] + "AAAA"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			principal, err := auth.Authenticate(tc.ctx, tc.authorization)
+			if tc.principal == "" {
+				assert.Equal(t, codes.Unauthenticated, status.Code(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.principal, principal)
+		})
+	}
+}
+
+// metadataContext returns the context of a request with the authorization header
+func metadataContext(authorization string) context.Context {
+	if authorization == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", authorization))
+}
+
+// recvStream is a server stream receiving a single message
+type recvStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	msg proto.Message
+}
+
+func (s *recvStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *recvStream) RecvMsg(m any) error {
+	proto.Merge(m.(proto.Message), s.msg)
+	return nil
+}
+
+func TestAuthStreamInterceptor(t *testing.T) {
+	auth := &Auth{
+		Authenticators: []Authenticator{StaticTokens{"secret": "alice"}},
+		Policy: &Policy{Rules: []Rule{
+			{Principals: []string{"alice"}, Prefixes: []string{"users/"}, Operations: []Operation{OpRead}},
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		msg           *pb.WatchRequest
+		code          codes.Code // of the stream, OK if the message is received
+	}{
+		{name: "allowed watch", authorization: "Bearer secret", msg: &pb.WatchRequest{Key: "users/alice"}, code: codes.OK},
+		{name: "denied watch", authorization: "Bearer secret", msg: &pb.WatchRequest{Key: "orders/1"}, code: codes.PermissionDenied},
+		{name: "unauthenticated", msg: &pb.WatchRequest{Key: "users/alice"}, code: codes.Unauthenticated},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := metadataContext(tc.authorization)
+			stream := &recvStream{ctx: ctx, msg: tc.msg}
+
+			var received *pb.WatchRequest
+			err := auth.StreamInterceptor(nil, stream, &grpc.StreamServerInfo{}, func(srv any, stream grpc.ServerStream) error {
+				principal, ok := PrincipalFromContext(stream.Context())
+				assert.True(t, ok)
+				assert.Equal(t, "alice", principal)
+
+				req := &pb.WatchRequest{}
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				received = req
+				return nil
+			})
+
+			assert.Equal(t, tc.code, status.Code(err))
+			if tc.code == codes.OK {
+				assert.Equal(t, tc.msg.GetKey(), received.GetKey())
+			} else {
+				assert.Nil(t, received)
+			}
+		})
+	}
+}
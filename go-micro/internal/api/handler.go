@@ -2,25 +2,46 @@ package api
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"go-micro/internal/store"
 	tl "go-micro/internal/transationLogger"
 	pb "go-micro/proto/store"
+	"math"
+	"slices"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
 type StoreServer struct {
 	pb.UnimplementedStoreServiceServer
-	KVStore store.Store
-	Logger  tl.TransactionLogger
+	KVStore        store.Store
+	Logger         tl.TransactionLogger
+	MaxRecordBytes int // writes the logger would reject are refused upfront, 0 disables
+
+	// a write holds its keys from the change of the store until the change
+	// is logged, so the writes of a key are logged in the order they were made
+	keys keyLocks
+
+	watchesMu   sync.Mutex
+	watchesDone chan struct{} // closed by StopWatches
 }
 
 func (s *StoreServer) GetHandler(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
 	key := req.GetKey()
 	res := &pb.GetResponse{Value: ""}
-	val, err := s.KVStore.Get(key)
+	span := startStoreSpan(ctx, "Get", keyAttr(key))
+	val, version, err := s.KVStore.Get(key)
+	endStoreSpan(span, err)
 
 	if errors.Is(err, store.ErrorNoSuchKey) {
 		return res, status.Errorf(codes.NotFound, "key:%s not found", key)
@@ -30,6 +51,7 @@ func (s *StoreServer) GetHandler(ctx context.Context, req *pb.GetRequest) (*pb.G
 	}
 
 	res.Value = val
+	res.Version = version
 	return res, nil
 }
 
@@ -38,24 +60,61 @@ func (s *StoreServer) PutHandler(ctx context.Context, req *pb.PutRequest) (*pb.P
 	val := req.GetValue()
 	res := &pb.PutResponse{}
 
-	// write to inmem store
-	err := s.KVStore.Put(key, val)
+	ttl, err := parseTTL(req.GetTtl())
+	if err != nil {
+		return res, err
+	}
+	if err := s.checkPutSize(key, val, ttl); err != nil {
+		return res, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return res, err
+	}
+
+	unlock := s.keys.lock(key)
+	defer unlock()
+	prev := s.KVStore.Lookup(key)
+
+	// keys without a ttl never expire
+	var version uint64
+	expiresAt := time.Now().Add(ttl)
+	span := startStoreSpan(ctx, "Put", keyAttr(key))
+	if ttl == 0 {
+		// write to inmem store
+		version, err = s.KVStore.Put(key, val)
+	} else {
+		version, err = s.KVStore.PutWithTTL(key, val, ttl)
+	}
+	endStoreSpan(span, err)
 	if err != nil {
 		return res, status.Errorf(codes.Internal, "internal server error: %s", err)
 	}
 
-	// write to logger
-	s.Logger.WritePut(key, val)
+	// write to logger, the put is only acknowledged once it is durable
+	if err := s.logPut(ctx, key, val, version, ttl, expiresAt); err != nil {
+		return res, s.revert(err, prev)
+	}
 
 	res.Key = key
 	res.Value = val
+	res.Version = version
 	return res, nil
 }
 
 func (s *StoreServer) DelHandler(ctx context.Context, req *pb.DelRequest) (*pb.DelResponse, error) {
 	key := req.GetKey()
 	res := &pb.DelResponse{}
-	val, err := s.KVStore.Del(key)
+	if err := s.checkWritable(); err != nil {
+		return res, err
+	}
+
+	unlock := s.keys.lock(key)
+	defer unlock()
+	prev := s.KVStore.Lookup(key)
+
+	span := startStoreSpan(ctx, "Del", keyAttr(key))
+	val, version, err := s.KVStore.Del(key)
+	endStoreSpan(span, err)
 
 	if errors.Is(err, store.ErrorNoSuchKey) {
 		return res, status.Errorf(codes.NotFound, "key:%s not found", key)
@@ -65,9 +124,339 @@ func (s *StoreServer) DelHandler(ctx context.Context, req *pb.DelRequest) (*pb.D
 	}
 
 	// write to db
-	s.Logger.WriteDel(key)
+	if err := s.Logger.WriteDelContext(logContext(ctx), key, version); err != nil {
+		return res, s.revert(err, prev)
+	}
+
+	res.Key = key
+	res.Value = val
+	res.Version = version
+	return res, nil
+}
+
+func (s *StoreServer) CompareAndSwap(ctx context.Context, req *pb.CompareAndSwapRequest) (*pb.CompareAndSwapResponse, error) {
+	key := req.GetKey()
+	val := req.GetValue()
+	res := &pb.CompareAndSwapResponse{}
+
+	ttl, err := parseTTL(req.GetTtl())
+	if err != nil {
+		return res, err
+	}
+
+	if err := s.checkPutSize(key, val, ttl); err != nil {
+		return res, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return res, err
+	}
+
+	unlock := s.keys.lock(key)
+	defer unlock()
+	prev := s.KVStore.Lookup(key)
+
+	expiresAt := time.Now().Add(ttl)
+	span := startStoreSpan(ctx, "CompareAndSwap", keyAttr(key))
+	version, err := s.KVStore.CompareAndSwap(key, val, req.GetVersion(), ttl)
+	endStoreSpan(span, err)
+	if errors.Is(err, store.ErrorVersionMismatch) {
+		return res, status.Errorf(codes.FailedPrecondition,
+			"key:%s is at version %d, expected %d", key, version, req.GetVersion())
+	}
+	if err != nil {
+		return res, status.Errorf(codes.Internal, "internal server error: %s", err)
+	}
+
+	if err := s.logPut(ctx, key, val, version, ttl, expiresAt); err != nil {
+		return res, s.revert(err, prev)
+	}
+
+	res.Key = key
+	res.Value = val
+	res.Version = version
+	return res, nil
+}
+
+func (s *StoreServer) PutIfAbsent(ctx context.Context, req *pb.PutIfAbsentRequest) (*pb.PutIfAbsentResponse, error) {
+	key := req.GetKey()
+	val := req.GetValue()
+	res := &pb.PutIfAbsentResponse{}
+
+	ttl, err := parseTTL(req.GetTtl())
+	if err != nil {
+		return res, err
+	}
+
+	if err := s.checkPutSize(key, val, ttl); err != nil {
+		return res, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return res, err
+	}
+
+	unlock := s.keys.lock(key)
+	defer unlock()
+	prev := s.KVStore.Lookup(key)
+
+	expiresAt := time.Now().Add(ttl)
+	span := startStoreSpan(ctx, "PutIfAbsent", keyAttr(key))
+	version, err := s.KVStore.PutIfAbsent(key, val, ttl)
+	endStoreSpan(span, err)
+	if errors.Is(err, store.ErrorKeyExists) {
+		return res, status.Errorf(codes.FailedPrecondition, "key:%s already exists at version %d", key, version)
+	}
+	if err != nil {
+		return res, status.Errorf(codes.Internal, "internal server error: %s", err)
+	}
+
+	if err := s.logPut(ctx, key, val, version, ttl, expiresAt); err != nil {
+		return res, s.revert(err, prev)
+	}
+
+	res.Key = key
+	res.Value = val
+	res.Version = version
+	return res, nil
+}
+
+func (s *StoreServer) DeleteIfVersion(ctx context.Context, req *pb.DeleteIfVersionRequest) (*pb.DeleteIfVersionResponse, error) {
+	key := req.GetKey()
+	res := &pb.DeleteIfVersionResponse{}
+	if err := s.checkWritable(); err != nil {
+		return res, err
+	}
+
+	unlock := s.keys.lock(key)
+	defer unlock()
+	prev := s.KVStore.Lookup(key)
+
+	span := startStoreSpan(ctx, "DelIfVersion", keyAttr(key))
+	val, err := s.KVStore.DelIfVersion(key, req.GetVersion())
+	endStoreSpan(span, err)
+
+	if errors.Is(err, store.ErrorNoSuchKey) {
+		return res, status.Errorf(codes.NotFound, "key:%s not found", key)
+	}
+	if errors.Is(err, store.ErrorVersionMismatch) {
+		return res, status.Errorf(codes.FailedPrecondition, "key:%s is not at version %d", key, req.GetVersion())
+	}
+	if err != nil {
+		return res, status.Errorf(codes.Internal, "internal server error: %s", err)
+	}
+
+	if err := s.Logger.WriteDelContext(logContext(ctx), key, req.GetVersion()); err != nil {
+		return res, s.revert(err, prev)
+	}
 
 	res.Key = key
 	res.Value = val
 	return res, nil
 }
+
+func (s *StoreServer) Scan(req *pb.ScanRequest, stream pb.StoreService_ScanServer) error {
+	limit := int(req.GetLimit())
+	switch {
+	case limit < 0:
+		return status.Errorf(codes.InvalidArgument, "limit must not be negative: %d", limit)
+	case limit == 0:
+		limit = defaultScanLimit
+	case limit > maxScanLimit:
+		limit = maxScanLimit
+	}
+
+	start := req.GetStart()
+	if token := req.GetPageToken(); token != "" {
+		resume, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid page token: %s", err)
+		}
+		start = max(start, string(resume))
+	}
+
+	span := startStoreSpan(stream.Context(), "Scan", attribute.String("kv.prefix", req.GetPrefix()))
+	kvs, next, err := s.KVStore.Scan(req.GetPrefix(), start, req.GetEnd(), limit)
+	endStoreSpan(span, err)
+	if err != nil {
+		return status.Errorf(codes.Internal, "internal server error: %s", err)
+	}
+
+	for i, kv := range kvs {
+		res := &pb.ScanResponse{Key: kv.Key, Value: kv.Value, Version: kv.Version}
+		if i == len(kvs)-1 && next != "" {
+			res.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(next))
+		}
+
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *StoreServer) Batch(ctx context.Context, req *pb.BatchRequest) (*pb.BatchResponse, error) {
+	res := &pb.BatchResponse{}
+	if len(req.GetOps()) == 0 {
+		return res, nil
+	}
+
+	now := time.Now()
+	ops := make([]store.Op, 0, len(req.GetOps()))
+	batch := make([]tl.Event, 0, len(req.GetOps()))
+	for i, op := range req.GetOps() {
+		ttl, err := parseTTL(op.GetTtl())
+		if err != nil {
+			return res, err
+		}
+
+		o := store.Op{
+			Key:          op.GetKey(),
+			Value:        op.GetValue(),
+			TTL:          ttl,
+			CheckVersion: op.GetCheckVersion(),
+			Version:      op.GetVersion(),
+		}
+		switch op.GetType() {
+		case pb.BatchOp_PUT:
+			o.Type = store.OpPut
+		case pb.BatchOp_DELETE:
+			o.Type = store.OpDelete
+		default:
+			return res, status.Errorf(codes.InvalidArgument, "op %d: invalid op type %d", i, op.GetType())
+		}
+		ops = append(ops, o)
+
+		sized := tl.Event{EventType: tl.EventDelete, Key: o.Key}
+		if o.Type == store.OpPut {
+			sized = tl.Event{EventType: tl.EventPut, Key: o.Key, Value: o.Value, ExpiresAt: maxExpiresAt(ttl)}
+		}
+		batch = append(batch, sized)
+	}
+	if err := s.checkRecordSize(tl.Event{EventType: tl.EventBatch, Batch: batch}); err != nil {
+		return res, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return res, err
+	}
+
+	keys := make([]string, 0, len(ops))
+	for _, op := range ops {
+		keys = append(keys, op.Key)
+	}
+	unlock := s.keys.lock(keys...)
+	defer unlock()
+	// a key written twice is reverted to its state before the batch
+	var prev []store.KeyValue
+	for _, key := range slices.Compact(slices.Sorted(slices.Values(keys))) {
+		prev = append(prev, s.KVStore.Lookup(key))
+	}
+
+	span := startStoreSpan(ctx, "Batch", attribute.Int("kv.batch.size", len(ops)))
+	results, err := s.KVStore.Batch(ops)
+	endStoreSpan(span, err)
+	if errors.Is(err, store.ErrorVersionMismatch) {
+		return res, status.Errorf(codes.FailedPrecondition, "batch not applied: %s", err)
+	}
+	if errors.Is(err, store.ErrorNoSuchKey) {
+		return res, status.Errorf(codes.NotFound, "batch not applied: %s", err)
+	}
+	if err != nil {
+		return res, status.Errorf(codes.Internal, "internal server error: %s", err)
+	}
+
+	// the whole batch is logged as one record
+	events := make([]tl.Event, 0, len(results))
+	for i, r := range results {
+		e := tl.Event{EventType: tl.EventDelete, Key: r.Key, Version: r.Version}
+		if ops[i].Type == store.OpPut {
+			e = tl.Event{EventType: tl.EventPut, Key: r.Key, Value: r.Value, Version: r.Version}
+			if ops[i].TTL > 0 {
+				e.ExpiresAt = now.Add(ops[i].TTL).UnixNano()
+			}
+		}
+		events = append(events, e)
+
+		res.Results = append(res.Results, &pb.BatchResult{Key: r.Key, Value: r.Value, Version: r.Version})
+	}
+	if err := s.Logger.WriteBatchContext(logContext(ctx), events); err != nil {
+		return res, s.revert(err, prev...)
+	}
+
+	return res, nil
+}
+
+// logPut writes the put to the logger, recording the deadline of keys with a ttl
+func (s *StoreServer) logPut(ctx context.Context, key, val string, version uint64, ttl time.Duration, expiresAt time.Time) error {
+	if ttl == 0 {
+		expiresAt = time.Time{}
+	}
+	return s.Logger.WritePutContext(logContext(ctx), key, val, version, expiresAt)
+}
+
+// logContext keeps the trace of ctx but not its cancellation, the outcome of
+// a write whose caller went away is still needed to keep or revert it
+func logContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+// revert sets the keys back to their state before a write which could not be
+// logged, while they are still locked, and converts the error of the logger,
+// a write which reached the log but was not synced is kept as it is replayed
+func (s *StoreServer) revert(err error, prev ...store.KeyValue) error {
+	if errors.Is(err, tl.ErrNotSynced) {
+		return status.Errorf(codes.Internal, "write was applied but may be lost in a crash: %s", err)
+	}
+	for _, kv := range prev {
+		s.KVStore.Revert(kv)
+	}
+	return logError(err)
+}
+
+// logError converts an error of the logger into a status,
+// the write was reverted in the store
+func logError(err error) error {
+	if errors.Is(err, tl.ErrReadOnly) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Errorf(codes.Internal, "error logging write: %s", err)
+}
+
+// checkWritable refuses a write the logger would not log,
+// before it changes the store
+func (s *StoreServer) checkWritable() error {
+	if err := s.Logger.Writable(); err != nil {
+		return status.Errorf(codes.Unavailable, "writes are refused: %s", err)
+	}
+	return nil
+}
+
+// checkPutSize refuses a put which would exceed the maximum record size
+func (s *StoreServer) checkPutSize(key, val string, ttl time.Duration) error {
+	return s.checkRecordSize(tl.Event{EventType: tl.EventPut, Key: key, Value: val, ExpiresAt: maxExpiresAt(ttl)})
+}
+
+func (s *StoreServer) checkRecordSize(e tl.Event) error {
+	if s.MaxRecordBytes <= 0 {
+		return nil
+	}
+	if size := tl.RecordSize(e); size > s.MaxRecordBytes {
+		return status.Errorf(codes.InvalidArgument, "write of %d bytes exceeds the maximum record size of %d", size, s.MaxRecordBytes)
+	}
+	return nil
+}
+
+// maxExpiresAt is a worst case deadline for sizing the record of a put with the ttl
+func maxExpiresAt(ttl time.Duration) int64 {
+	if ttl == 0 {
+		return 0
+	}
+	return math.MaxInt64
+}
+
+// parseTTL converts the ttl of a request in seconds to a duration
+func parseTTL(seconds int64) (time.Duration, error) {
+	if seconds < 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "ttl must not be negative: %d", seconds)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-micro/internal/store"
+	tl "go-micro/internal/transationLogger"
+	pb "go-micro/proto/store"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStoreServerLogOrder(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+	logger, err := tl.NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	kvstore := store.NewKVStore()
+	assert.NoError(t, tl.InitalizeTrasactionLogger(logger, kvstore, nil))
+	s := &StoreServer{KVStore: kvstore, Logger: delayedLogger{logger}}
+
+	// writers race on a few keys, the log has to end up with the store's order
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := fmt.Sprintf("key-%d", i%3)
+				switch i % 5 {
+				case 3:
+					s.DelHandler(ctx, &pb.DelRequest{Key: key})
+				case 4:
+					s.Batch(ctx, &pb.BatchRequest{Ops: []*pb.BatchOp{
+						{Type: pb.BatchOp_PUT, Key: key, Value: fmt.Sprintf("batch-%d-%d", w, i)},
+						{Type: pb.BatchOp_PUT, Key: "key-0", Value: fmt.Sprintf("batch-%d-%d", w, i)},
+					}})
+				default:
+					_, err := s.PutHandler(ctx, &pb.PutRequest{Key: key, Value: fmt.Sprintf("put-%d-%d", w, i)})
+					assert.NoError(t, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, logger.Close(ctx))
+
+	restarted, err := tl.NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	replayed := store.NewKVStore()
+	assert.NoError(t, tl.InitalizeTrasactionLogger(restarted, replayed, nil))
+	defer restarted.Close(ctx)
+
+	assert.Equal(t, kvstore.Snapshot(), replayed.Snapshot())
+}
+
+// delayedLogger widens the gap between the change of the store and its log write
+type delayedLogger struct {
+	tl.TransactionLogger
+}
+
+func delay() {
+	time.Sleep(time.Duration(rand.IntN(200)) * time.Microsecond)
+}
+
+func (l delayedLogger) WritePutContext(ctx context.Context, key, value string, version uint64, expiresAt time.Time) error {
+	delay()
+	return l.TransactionLogger.WritePutContext(ctx, key, value, version, expiresAt)
+}
+
+func (l delayedLogger) WriteDelContext(ctx context.Context, key string, version uint64) error {
+	delay()
+	return l.TransactionLogger.WriteDelContext(ctx, key, version)
+}
+
+func (l delayedLogger) WriteBatchContext(ctx context.Context, events []tl.Event) error {
+	delay()
+	return l.TransactionLogger.WriteBatchContext(ctx, events)
+}
+
+// failingLogger accepts writes but fails to log them
+type failingLogger struct {
+	tl.TransactionLogger
+}
+
+var errDiskFull = errors.New("no space left on device")
+
+func (failingLogger) Writable() error { return nil }
+
+func (failingLogger) WritePutContext(context.Context, string, string, uint64, time.Time) error {
+	return errDiskFull
+}
+
+func (failingLogger) WriteDelContext(context.Context, string, uint64) error { return errDiskFull }
+
+func (failingLogger) WriteBatchContext(context.Context, []tl.Event) error { return errDiskFull }
+
+// unsyncedLogger logs writes but fails to sync them
+type unsyncedLogger struct {
+	failingLogger
+}
+
+var errNotSynced = fmt.Errorf("%w: %s", tl.ErrNotSynced, errDiskFull)
+
+func (unsyncedLogger) WritePutContext(context.Context, string, string, uint64, time.Time) error {
+	return errNotSynced
+}
+
+func (unsyncedLogger) WriteDelContext(context.Context, string, uint64) error { return errNotSynced }
+
+func (unsyncedLogger) WriteBatchContext(context.Context, []tl.Event) error { return errNotSynced }
+
+func TestStoreServerRevert(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(s *StoreServer) error
+	}{
+		{
+			name: "put",
+			write: func(s *StoreServer) error {
+				_, err := s.PutHandler(context.Background(), &pb.PutRequest{Key: "a", Value: "new", Ttl: 60})
+				return err
+			},
+		}, {
+			name: "put of a new key",
+			write: func(s *StoreServer) error {
+				_, err := s.PutHandler(context.Background(), &pb.PutRequest{Key: "new", Value: "new"})
+				return err
+			},
+		}, {
+			name: "del",
+			write: func(s *StoreServer) error {
+				_, err := s.DelHandler(context.Background(), &pb.DelRequest{Key: "b"})
+				return err
+			},
+		}, {
+			name: "compare and swap",
+			write: func(s *StoreServer) error {
+				_, err := s.CompareAndSwap(context.Background(), &pb.CompareAndSwapRequest{Key: "a", Value: "new", Version: 2})
+				return err
+			},
+		}, {
+			name: "put if absent",
+			write: func(s *StoreServer) error {
+				_, err := s.PutIfAbsent(context.Background(), &pb.PutIfAbsentRequest{Key: "new", Value: "new"})
+				return err
+			},
+		}, {
+			name: "delete if version",
+			write: func(s *StoreServer) error {
+				_, err := s.DeleteIfVersion(context.Background(), &pb.DeleteIfVersionRequest{Key: "a", Version: 2})
+				return err
+			},
+		}, {
+			name: "batch",
+			write: func(s *StoreServer) error {
+				_, err := s.Batch(context.Background(), &pb.BatchRequest{Ops: []*pb.BatchOp{
+					{Type: pb.BatchOp_PUT, Key: "a", Value: "first"},
+					{Type: pb.BatchOp_DELETE, Key: "b"},
+					{Type: pb.BatchOp_PUT, Key: "a", Value: "second"},
+					{Type: pb.BatchOp_PUT, Key: "new", Value: "new"},
+				}})
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kvstore := store.NewKVStore()
+			kvstore.Put("a", "old")
+			kvstore.PutWithTTL("a", "old", time.Hour)
+			kvstore.Put("b", "old")
+			before := kvstore.Snapshot()
+
+			s := &StoreServer{KVStore: kvstore, Logger: failingLogger{}}
+			err := tc.write(s)
+			assert.Equal(t, codes.Internal, status.Code(err))
+			assert.ErrorContains(t, err, errDiskFull.Error())
+
+			// a write which is not logged is not kept either
+			assert.Equal(t, before, kvstore.Snapshot())
+
+			// a write which is logged is replayed even if it was not synced, so it is kept
+			s.Logger = unsyncedLogger{}
+			err = tc.write(s)
+			assert.Equal(t, codes.Internal, status.Code(err))
+			assert.ErrorContains(t, err, "may be lost")
+			assert.NotEqual(t, before, kvstore.Snapshot())
+		})
+	}
+}
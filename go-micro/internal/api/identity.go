@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Identity is the client of a request as authenticated by the
+// certificate it presented over mutual tls
+type Identity struct {
+	Subject    string // distinguished name of the certificate, CN=client,O=example
+	CommonName string
+}
+
+// ClientIdentity returns the identity of the verified client certificate
+// of the request, false for plaintext and tls without client certificates
+func ClientIdentity(ctx context.Context) (Identity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	return Identity{Subject: cert.Subject.String(), CommonName: cert.Subject.CommonName}, true
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"hash/fnv"
+	"slices"
+	"sync"
+)
+
+// keyLockStripes is the number of mutexes the keys are spread over
+const keyLockStripes = 1024
+
+// keyLocks serializes the writes of a key from the change of the store until
+// it is logged, keys share a fixed number of mutexes so that the locks take no
+// memory per key, writes of different keys may wait for each other
+type keyLocks struct {
+	stripes [keyLockStripes]sync.Mutex
+}
+
+// lock locks the keys and returns the function unlocking them,
+// the stripes are locked in ascending order so overlapping sets do not deadlock
+func (l *keyLocks) lock(keys ...string) (unlock func()) {
+	stripes := make([]uint32, 0, len(keys))
+	for _, key := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		stripes = append(stripes, h.Sum32()%keyLockStripes)
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, i := range stripes {
+		l.stripes[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			l.stripes[i].Unlock()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CallInfo collects what the interceptors down the chain learn about
+// a call, for the logging and auditing ones which wrap them
+type CallInfo struct {
+	Principal string // empty until the call is authenticated
+}
+
+type callInfoKey struct{}
+
+// WithCallInfo returns a context carrying a CallInfo, or ctx if it already has one
+func WithCallInfo(ctx context.Context) (context.Context, *CallInfo) {
+	if info, ok := ctx.Value(callInfoKey{}).(*CallInfo); ok {
+		return ctx, info
+	}
+	info := &CallInfo{}
+	return context.WithValue(ctx, callInfoKey{}, info), info
+}
+
+// UnaryLoggingInterceptor logs every unary call once it returns
+func UnaryLoggingInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, call := WithCallInfo(ctx)
+	start := time.Now()
+	res, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, call, start, err)
+	return res, err
+}
+
+// StreamLoggingInterceptor logs every streaming call once it ends
+func StreamLoggingInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, call := WithCallInfo(stream.Context())
+	start := time.Now()
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	logCall(ctx, info.FullMethod, call, start, err)
+	return err
+}
+
+// serverErrors are the codes logged as errors, the rest are the client's fault
+var serverErrors = map[codes.Code]bool{
+	codes.Unknown:     true,
+	codes.Internal:    true,
+	codes.Unavailable: true,
+	codes.DataLoss:    true,
+}
+
+func logCall(ctx context.Context, method string, call *CallInfo, start time.Time, err error) {
+	code := status.Code(err)
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if call.Principal != "" {
+		attrs = append(attrs, slog.String("principal", call.Principal))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("err", status.Convert(err).Message()))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", span.TraceID().String()))
+	}
+
+	level := slog.LevelInfo
+	switch {
+	case serverErrors[code]:
+		level = slog.LevelError
+	case strings.HasPrefix(method, "/grpc.health.v1.Health/"):
+		// the probes of the orchestrator would drown the calls
+		level = slog.LevelDebug
+	}
+	slog.LogAttrs(ctx, level, "grpc call", attrs...)
+}
+
+// contextStream replaces the context of a stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	pb "go-micro/proto/store"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// captureLogs sends the default logger to a buffer for the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestUnaryLoggingInterceptor(t *testing.T) {
+	auth := &Auth{
+		Authenticators: []Authenticator{StaticTokens{"billing-token": "billing"}},
+		Policy: &Policy{Rules: []Rule{
+			{Principals: []string{"billing"}, Prefixes: []string{"invoices/", "fail/"}, Operations: []Operation{OpRead, OpWrite}},
+		}},
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		req           any
+		level         string
+		code          string
+		principal     string // empty if the call is not authenticated
+		err           string
+	}{
+		{
+			name:          "put",
+			method:        "/store.StoreService/PutHandler",
+			authorization: "Bearer billing-token",
+			req:           &pb.PutRequest{Key: "invoices/1", Value: secretValue},
+			level:         "INFO",
+			code:          "OK",
+			principal:     "billing",
+		}, {
+			name:          "client error",
+			method:        "/store.StoreService/PutHandler",
+			authorization: "Bearer billing-token",
+			req:           &pb.PutRequest{Key: "orders/1", Value: secretValue},
+			level:         "INFO",
+			code:          "PermissionDenied",
+			principal:     "billing",
+			err:           "billing may not write key:orders/1",
+		}, {
+			name:   "unauthenticated",
+			method: "/store.StoreService/PutHandler",
+			req:    &pb.PutRequest{Key: "invoices/1", Value: secretValue},
+			level:  "INFO",
+			code:   "Unauthenticated",
+			err:    "missing bearer token",
+		}, {
+			name:          "server error",
+			method:        "/store.StoreService/PutHandler",
+			authorization: "Bearer billing-token",
+			req:           &pb.PutRequest{Key: "fail/1", Value: secretValue},
+			level:         "ERROR",
+			code:          "Internal",
+			principal:     "billing",
+			err:           "error writing transaction log: disk full",
+		}, {
+			name:          "health probe",
+			method:        "/grpc.health.v1.Health/Check",
+			authorization: "Bearer billing-token",
+			req:           &healthpb.HealthCheckRequest{},
+			level:         "DEBUG",
+			code:          "OK",
+			principal:     "billing",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			// the logging wraps the authentication as in the server
+			info := &grpc.UnaryServerInfo{FullMethod: tc.method}
+			UnaryLoggingInterceptor(metadataContext(tc.authorization), tc.req, info,
+				func(ctx context.Context, req any) (any, error) {
+					return auth.UnaryInterceptor(ctx, req, info, stubHandler)
+				})
+
+			var line map[string]any
+			assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+			assert.Equal(t, "grpc call", line["msg"])
+			assert.Equal(t, tc.level, line["level"])
+			assert.Equal(t, tc.method, line["method"])
+			assert.Equal(t, tc.code, line["code"])
+			assert.Contains(t, line, "duration")
+			if tc.principal != "" {
+				assert.Equal(t, tc.principal, line["principal"])
+			} else {
+				assert.NotContains(t, line, "principal")
+			}
+			if tc.err != "" {
+				assert.Equal(t, tc.err, line["err"])
+			} else {
+				assert.NotContains(t, line, "err")
+			}
+			assert.NotContains(t, logs.String(), secretValue)
+		})
+	}
+}
+
+func TestStreamLoggingInterceptor(t *testing.T) {
+	logs := captureLogs(t)
+	auth := &Auth{Authenticators: []Authenticator{StaticTokens{"billing-token": "billing"}}}
+
+	stream := &recvStream{ctx: metadataContext("Bearer billing-token"), msg: &pb.WatchRequest{Key: "invoices/1"}}
+	info := &grpc.StreamServerInfo{FullMethod: "/store.StoreService/Watch"}
+	err := StreamLoggingInterceptor(nil, stream, info, func(srv any, stream grpc.ServerStream) error {
+		return auth.StreamInterceptor(srv, stream, info, func(srv any, stream grpc.ServerStream) error {
+			return stream.RecvMsg(&pb.WatchRequest{})
+		})
+	})
+	assert.NoError(t, err)
+
+	var line map[string]any
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	assert.Equal(t, "grpc call", line["msg"])
+	assert.Equal(t, "/store.StoreService/Watch", line["method"])
+	assert.Equal(t, "OK", line["code"])
+	assert.Equal(t, "billing", line["principal"])
+}
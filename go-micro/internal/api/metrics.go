@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var rpcSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "kv",
+	Subsystem: "grpc",
+	Name:      "request_seconds",
+	Help:      "Time to serve a grpc call by method and status code, streams last until they end.",
+	Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+}, []string{"method", "code"})
+
+// Collectors returns the metrics of the interceptors,
+// to be registered with the registry /metrics serves
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{rpcSeconds}
+}
+
+// UnaryMetricsInterceptor counts the unary calls and observes their latency
+func UnaryMetricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	res, err := handler(ctx, req)
+	observeRPC(info.FullMethod, start, err)
+	return res, err
+}
+
+// StreamMetricsInterceptor counts the streaming calls and observes how long they ran
+func StreamMetricsInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, stream)
+	observeRPC(info.FullMethod, start, err)
+	return err
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	rpcSeconds.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// StartReaper spins up a go routine which removes the expired keys every
+// interval and logs their expiry, calling the returned function stops
+// the reaper and waits for it
+func (s *StoreServer) StartReaper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(finished)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.Reap()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-finished
+	}
+}
+
+// Reap removes the expired keys and logs their expiry
+func (s *StoreServer) Reap() {
+	for _, key := range s.KVStore.Expired() {
+		s.reap(key)
+	}
+}
+
+// reap expires the key and logs it under the lock of the key like a write,
+// so a write re-creating the key is logged after the expiry
+func (s *StoreServer) reap(key string) {
+	unlock := s.keys.lock(key)
+	defer unlock()
+
+	// a write may have replaced the key since it was listed
+	version, ok := s.KVStore.Expire(key)
+	if !ok {
+		return
+	}
+	s.Logger.WriteExpire(key, version)
+}
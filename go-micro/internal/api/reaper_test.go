@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"go-micro/internal/store"
+	tl "go-micro/internal/transationLogger"
+	pb "go-micro/proto/store"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedLogger holds the expiry of a key until it is released
+type gatedLogger struct {
+	tl.TransactionLogger
+	expiring chan struct{}
+	release  chan struct{}
+}
+
+func (l gatedLogger) WriteExpire(key string, version uint64) {
+	close(l.expiring)
+	<-l.release
+	l.TransactionLogger.WriteExpire(key, version)
+}
+
+func TestStoreServerReap(t *testing.T) {
+	ctx := context.Background()
+	tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+	logger, err := tl.NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	kvstore := store.NewKVStore()
+	assert.NoError(t, tl.InitalizeTrasactionLogger(logger, kvstore, nil))
+
+	version, err := kvstore.PutWithTTL("session", "value", time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, logger.WritePutContext(ctx, "session", "value", version, time.Now().Add(time.Millisecond)))
+	time.Sleep(5 * time.Millisecond)
+
+	gated := gatedLogger{TransactionLogger: logger, expiring: make(chan struct{}), release: make(chan struct{})}
+	s := &StoreServer{KVStore: kvstore, Logger: gated}
+	reaped := make(chan struct{})
+	go func() {
+		s.Reap()
+		close(reaped)
+	}()
+	<-gated.expiring
+
+	// the put of the expired key waits until its expiry is logged
+	put := make(chan error, 1)
+	go func() {
+		_, err := s.PutHandler(ctx, &pb.PutRequest{Key: "session", Value: "again"})
+		put <- err
+	}()
+	select {
+	case <-put:
+		t.Fatal("put of the key was logged before its expiry")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(gated.release)
+	<-reaped
+	assert.NoError(t, <-put)
+	assert.NoError(t, logger.Close(ctx))
+
+	restarted, err := tl.NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	replayed := store.NewKVStore()
+	assert.NoError(t, tl.InitalizeTrasactionLogger(restarted, replayed, nil))
+	defer restarted.Close(ctx)
+
+	value, _, err := replayed.Get("session")
+	assert.NoError(t, err)
+	assert.Equal(t, "again", value)
+	assert.Equal(t, kvstore.Snapshot(), replayed.Snapshot())
+}
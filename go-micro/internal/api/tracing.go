@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"go-micro/internal/store"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the spans of the calls themselves come from the otelgrpc stats handler
+// of the server, which continues the trace of the incoming metadata
+var tracer = otel.Tracer("go-micro/internal/api")
+
+// startStoreSpan starts the span of an operation of the in memory store
+func startStoreSpan(ctx context.Context, op string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer.Start(ctx, "store."+op, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endStoreSpan ends the span, the misses and conflicts of the
+// conditional operations are recorded but do not fail the span
+func endStoreSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		if !errors.Is(err, store.ErrorNoSuchKey) && !errors.Is(err, store.ErrorVersionMismatch) && !errors.Is(err, store.ErrorKeyExists) {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+func keyAttr(key string) attribute.KeyValue {
+	return attribute.String("kv.key", key)
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	tl "go-micro/internal/transationLogger"
+	pb "go-micro/proto/store"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Watch streams the logged events of a key or prefix, events before
+// the subscription are replayed from the log when from_event_id is set
+func (s *StoreServer) Watch(req *pb.WatchRequest, stream pb.StoreService_WatchServer) error {
+	ctx := stream.Context()
+	stopped := s.watchesStopped()
+
+	// subscribe before replaying so no event falls between the log and the live feed
+	live, unsubscribe := s.Logger.Subscribe()
+	defer unsubscribe()
+
+	var lastId uint64
+	if from := req.GetFromEventId(); from > 0 {
+		upTo := s.Logger.GetLastEventId()
+		if from <= upTo {
+			var err error
+			lastId, err = s.replay(req, from, upTo, stream)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-stopped:
+			return status.Errorf(codes.Unavailable, "server is shutting down, resume from event %d", lastId+1)
+		case e, ok := <-live:
+			if !ok {
+				return status.Errorf(codes.Aborted, "watcher fell behind, resume from event %d", lastId+1)
+			}
+			if e.Id <= lastId {
+				continue
+			}
+
+			if err := sendWatchEvent(req, e, stream); err != nil {
+				return err
+			}
+			lastId = e.Id
+		}
+	}
+}
+
+// StopWatches ends the open watch streams and the ones started later,
+// a graceful stop of the server would wait for their clients otherwise
+func (s *StoreServer) StopWatches() {
+	s.watchesMu.Lock()
+	defer s.watchesMu.Unlock()
+
+	done := s.watchesDoneLocked()
+	select {
+	case <-done:
+	default:
+		close(done)
+	}
+}
+
+func (s *StoreServer) watchesStopped() <-chan struct{} {
+	s.watchesMu.Lock()
+	defer s.watchesMu.Unlock()
+	return s.watchesDoneLocked()
+}
+
+func (s *StoreServer) watchesDoneLocked() chan struct{} {
+	if s.watchesDone == nil {
+		s.watchesDone = make(chan struct{})
+	}
+	return s.watchesDone
+}
+
+// replay sends the logged events in [from, upTo] and returns the last id sent
+func (s *StoreServer) replay(req *pb.WatchRequest, from, upTo uint64, stream pb.StoreService_WatchServer) (uint64, error) {
+	events, errs := s.Logger.ReadEvents()
+
+	// drain the reader if we bail out early
+	defer func() {
+		for range events {
+		}
+	}()
+
+	var lastId uint64
+	for e := range events {
+		if e.EventType == tl.EventCompacted && from <= e.Id {
+			return lastId, status.Errorf(codes.OutOfRange, "events up to %d were compacted into a snapshot", e.Id)
+		}
+		if e.Id < from || e.Id > upTo {
+			continue
+		}
+
+		if err := sendWatchEvent(req, e, stream); err != nil {
+			return lastId, err
+		}
+		lastId = e.Id
+	}
+
+	// the readers leave out the torn record of an event still in flight,
+	// which is delivered live, any other error lost events of the log
+	if err := <-errs; err != nil {
+		var corrupt *tl.CorruptRecordError
+		if errors.As(err, &corrupt) || errors.Is(err, tl.ErrTornRecord) {
+			return lastId, status.Errorf(codes.DataLoss, "error replaying log: %s", err)
+		}
+		return lastId, status.Errorf(codes.Internal, "error replaying log: %s", err)
+	}
+
+	return lastId, nil
+}
+
+// sendWatchEvent sends the event, or the entries of a batch, matching the request
+func sendWatchEvent(req *pb.WatchRequest, e tl.Event, stream pb.StoreService_WatchServer) error {
+	events := []tl.Event{e}
+	if e.EventType == tl.EventBatch {
+		events = e.Batch
+	}
+
+	for _, sub := range events {
+		if !watchMatches(req, sub.Key) {
+			continue
+		}
+
+		res := &pb.WatchResponse{EventId: e.Id, Key: sub.Key}
+		switch sub.EventType {
+		case tl.EventPut:
+			res.Type = pb.WatchResponse_PUT
+			res.Value = sub.Value
+			res.Version = sub.Version
+		case tl.EventDelete:
+			res.Type = pb.WatchResponse_DELETE
+			res.Version = sub.Version
+		case tl.EventExpire:
+			res.Type = pb.WatchResponse_EXPIRE
+			res.Version = sub.Version
+		default:
+			continue
+		}
+
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func watchMatches(req *pb.WatchRequest, key string) bool {
+	if req.GetPrefix() {
+		return strings.HasPrefix(key, req.GetKey())
+	}
+	return key == req.GetKey()
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tl "go-micro/internal/transationLogger"
+	pb "go-micro/proto/store"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// replayLogger replays its events followed by err, its live feed is closed
+type replayLogger struct {
+	tl.TransactionLogger
+	events []tl.Event
+	err    error
+}
+
+func (l *replayLogger) GetLastEventId() uint64 {
+	return l.events[len(l.events)-1].Id
+}
+
+func (l *replayLogger) ReadEvents() (<-chan tl.Event, <-chan error) {
+	events := make(chan tl.Event, len(l.events))
+	errs := make(chan error, 1)
+	for _, e := range l.events {
+		events <- e
+	}
+	close(events)
+	errs <- l.err
+	return events, errs
+}
+
+func (l *replayLogger) Subscribe() (<-chan tl.Event, func()) {
+	live := make(chan tl.Event)
+	close(live)
+	return live, func() {}
+}
+
+// sendStream records the responses sent on a watch stream
+type sendStream struct {
+	grpc.ServerStream
+	sent []*pb.WatchResponse
+}
+
+func (s *sendStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *sendStream) Send(res *pb.WatchResponse) error {
+	s.sent = append(s.sent, res)
+	return nil
+}
+
+func TestWatchReplayErrors(t *testing.T) {
+	events := []tl.Event{
+		{Id: 1, EventType: tl.EventPut, Key: "a", Value: "1", Version: 1},
+		{Id: 2, EventType: tl.EventPut, Key: "a", Value: "2", Version: 2},
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		// the live feed closes once the log is replayed
+		{name: "replayed", code: codes.Aborted},
+		{name: "corrupt record", err: &tl.CorruptRecordError{Path: "transactions.log", Offset: 64, EventId: 3}, code: codes.DataLoss},
+		{name: "torn record of a sealed segment", err: fmt.Errorf("segment 1: %w", tl.ErrTornRecord), code: codes.DataLoss},
+		{name: "error after the newest event", err: errors.New("invalid sequence number"), code: codes.Internal},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &StoreServer{Logger: &replayLogger{events: events, err: tc.err}}
+			stream := &sendStream{}
+
+			err := s.Watch(&pb.WatchRequest{Key: "a", FromEventId: 1}, stream)
+			assert.Equal(t, tc.code, status.Code(err), err)
+			assert.Len(t, stream.sent, len(events))
+		})
+	}
+}
+
+func TestWatchResponses(t *testing.T) {
+	events := []tl.Event{
+		{Id: 1, EventType: tl.EventPut, Key: "a", Value: "1", Version: 1},
+		{Id: 2, EventType: tl.EventDelete, Key: "a", Version: 1},
+		{Id: 3, EventType: tl.EventPut, Key: "a", Value: "2", Version: 3},
+		{Id: 4, EventType: tl.EventExpire, Key: "a", Version: 3},
+		{Id: 5, EventType: tl.EventBatch, Batch: []tl.Event{
+			{EventType: tl.EventPut, Key: "a", Value: "3", Version: 5},
+			{EventType: tl.EventPut, Key: "b", Value: "3", Version: 5},
+			{EventType: tl.EventDelete, Key: "a", Version: 5},
+		}},
+	}
+	s := &StoreServer{Logger: &replayLogger{events: events}}
+	stream := &sendStream{}
+
+	// deletes and expiries carry the version they removed
+	err := s.Watch(&pb.WatchRequest{Key: "a", FromEventId: 1}, stream)
+	assert.Equal(t, codes.Aborted, status.Code(err), err)
+	expected := []*pb.WatchResponse{
+		{EventId: 1, Type: pb.WatchResponse_PUT, Key: "a", Value: "1", Version: 1},
+		{EventId: 2, Type: pb.WatchResponse_DELETE, Key: "a", Version: 1},
+		{EventId: 3, Type: pb.WatchResponse_PUT, Key: "a", Value: "2", Version: 3},
+		{EventId: 4, Type: pb.WatchResponse_EXPIRE, Key: "a", Version: 3},
+		{EventId: 5, Type: pb.WatchResponse_PUT, Key: "a", Value: "3", Version: 5},
+		{EventId: 5, Type: pb.WatchResponse_DELETE, Key: "a", Version: 5},
+	}
+	assert.Len(t, stream.sent, len(expected))
+	for i, res := range stream.sent {
+		assert.True(t, proto.Equal(expected[i], res), "response %d: %v", i, res)
+	}
+}
@@ -1,48 +1,417 @@
 package store
 
-import "sync"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value   string
+	version uint64
+}
 
 type KVStore struct {
 	sync.RWMutex
-	m map[string]string
+	m        map[string]entry
+	expires  map[string]time.Time // deadlines of keys put with a ttl
+	index    *skiplist            // keys in sorted order for scans
+	bytes    int64                // sum of the key and value lengths
+	revision uint64               // version of the last write, deletes keep it
 }
 
 func NewKVStore() *KVStore {
 	return &KVStore{
-		m: make(map[string]string),
+		m:       make(map[string]entry),
+		expires: make(map[string]time.Time),
+		index:   newSkiplist(),
 	}
 }
 
-func (k *KVStore) Put(key, value string) error {
+// Put stores the key and returns its new version
+func (k *KVStore) Put(key, value string) (uint64, error) {
 	k.Lock()
 	defer k.Unlock()
-	k.m[key] = value
-	return nil
+	return k.putLocked(key, value, 0, time.Now()), nil
 }
 
-// returns val of the key
-func (k *KVStore) Get(key string) (string, error) {
+// PutWithTTL stores the key which expires once ttl has elapsed
+func (k *KVStore) PutWithTTL(key, value string, ttl time.Duration) (uint64, error) {
+	k.Lock()
+	defer k.Unlock()
+	return k.putLocked(key, value, ttl, time.Now()), nil
+}
+
+// returns val and version of the key
+func (k *KVStore) Get(key string) (string, uint64, error) {
 	k.RLock()
-	defer k.RUnlock()
+	e, ok := k.m[key]
+	deadline, hasTTL := k.expires[key]
+	k.RUnlock()
+
+	// an expired key is left for the reaper, which logs its expiry
+	if !ok || (hasTTL && !time.Now().Before(deadline)) {
+		return "", 0, ErrorNoSuchKey
+	}
+
+	return e.value, e.version, nil
+}
 
-	val, ok := k.m[key]
+// return val and version that is being deleted and error
+func (k *KVStore) Del(key string) (string, uint64, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	e, ok := k.lookupLocked(key, time.Now())
 	if !ok {
-		return "", ErrorNoSuchKey
+		return "", 0, ErrorNoSuchKey
+	}
+
+	k.deleteLocked(key)
+	return e.value, e.version, nil
+}
+
+// CompareAndSwap stores the key only if its current version matches,
+// version 0 expects the key to be absent
+func (k *KVStore) CompareAndSwap(key, value string, version uint64, ttl time.Duration) (uint64, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	now := time.Now()
+	e, _ := k.lookupLocked(key, now)
+	if e.version != version {
+		return e.version, ErrorVersionMismatch
+	}
+
+	return k.putLocked(key, value, ttl, now), nil
+}
+
+// PutIfAbsent stores the key only if it does not exist yet
+func (k *KVStore) PutIfAbsent(key, value string, ttl time.Duration) (uint64, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	now := time.Now()
+	if e, ok := k.lookupLocked(key, now); ok {
+		return e.version, ErrorKeyExists
 	}
 
-	return val, nil
+	return k.putLocked(key, value, ttl, now), nil
 }
 
-// return val that is being deleted and error
-func (k *KVStore) Del(key string) (string, error) {
+// DelIfVersion deletes the key only if its current version matches
+func (k *KVStore) DelIfVersion(key string, version uint64) (string, error) {
 	k.Lock()
 	defer k.Unlock()
 
-	val, ok := k.m[key]
+	e, ok := k.lookupLocked(key, time.Now())
 	if !ok {
 		return "", ErrorNoSuchKey
 	}
+	if e.version != version {
+		return "", ErrorVersionMismatch
+	}
+
+	k.deleteLocked(key)
+	return e.value, nil
+}
+
+// Batch validates every op against the state left by the ops before it
+// and only then applies them, so a failing op leaves the store untouched
+func (k *KVStore) Batch(ops []Op) ([]KeyValue, error) {
+	k.Lock()
+	defer k.Unlock()
 
+	type staged struct {
+		e  entry
+		ok bool
+	}
+
+	now := time.Now()
+	revision := k.revision
+	overlay := make(map[string]staged)
+	lookup := func(key string) (entry, bool) {
+		if st, ok := overlay[key]; ok {
+			return st.e, st.ok
+		}
+		return k.lookupLocked(key, now)
+	}
+
+	for i, op := range ops {
+		e, ok := lookup(op.Key)
+		if op.CheckVersion && e.version != op.Version {
+			return nil, fmt.Errorf("op %d on key %s at version %d: %w", i, op.Key, e.version, ErrorVersionMismatch)
+		}
+
+		switch op.Type {
+		case OpPut:
+			revision++
+			overlay[op.Key] = staged{e: entry{value: op.Value, version: revision}, ok: true}
+		case OpDelete:
+			if !ok {
+				return nil, fmt.Errorf("op %d on key %s: %w", i, op.Key, ErrorNoSuchKey)
+			}
+			overlay[op.Key] = staged{}
+		default:
+			return nil, fmt.Errorf("op %d on key %s: invalid op type %d", i, op.Key, op.Type)
+		}
+	}
+
+	results := make([]KeyValue, 0, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			version := k.putLocked(op.Key, op.Value, op.TTL, now)
+			results = append(results, KeyValue{Key: op.Key, Value: op.Value, Version: version})
+		case OpDelete:
+			e := k.m[op.Key]
+			k.deleteLocked(op.Key)
+			results = append(results, KeyValue{Key: op.Key, Value: e.value, Version: e.version})
+		}
+	}
+
+	return results, nil
+}
+
+// Restore writes the key as recorded in the transaction log, a put of a version
+// the key is already at or past is stale and ignored, and keys whose
+// deadline has already passed are removed instead
+func (k *KVStore) Restore(key, value string, version uint64, expiresAt time.Time) error {
+	k.Lock()
+	defer k.Unlock()
+
+	now := time.Now()
+	current, ok := k.lookupLocked(key, now)
+	if ok && version != 0 && version <= current.version {
+		return nil
+	}
+
+	if version == 0 {
+		version = k.revision + 1
+	}
+	k.revision = max(k.revision, version)
+
+	if !expiresAt.IsZero() && !now.Before(expiresAt) {
+		k.deleteLocked(key)
+		return nil
+	}
+
+	k.setLocked(key, entry{value: value, version: version})
+	if expiresAt.IsZero() {
+		delete(k.expires, key)
+	} else {
+		k.expires[key] = expiresAt
+	}
+
+	return nil
+}
+
+// RestoreDel removes the key as recorded in the transaction log if it is
+// still at the version that was removed, version 0 removes it at any version
+func (k *KVStore) RestoreDel(key string, version uint64) error {
+	k.Lock()
+	defer k.Unlock()
+
+	k.revision = max(k.revision, version)
+	current, ok := k.lookupLocked(key, time.Now())
+	if ok && (version == 0 || version == current.version) {
+		k.deleteLocked(key)
+	}
+	return nil
+}
+
+// Revision returns the version the last write got
+func (k *KVStore) Revision() uint64 {
+	k.RLock()
+	defer k.RUnlock()
+	return k.revision
+}
+
+// RestoreRevision raises the revision to the one of a snapshot,
+// which remembers the versions of the keys deleted before it
+func (k *KVStore) RestoreRevision(revision uint64) {
+	k.Lock()
+	defer k.Unlock()
+	k.revision = max(k.revision, revision)
+}
+
+// Scan walks the ordered index from max(prefix, start),
+// expired keys which have not been reaped yet are skipped
+func (k *KVStore) Scan(prefix, start, end string, limit int) ([]KeyValue, string, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	if start < prefix {
+		start = prefix
+	}
+
+	now := time.Now()
+	var kvs []KeyValue
+	for x := k.index.seek(start); x != nil; x = x.next[0] {
+		if !strings.HasPrefix(x.key, prefix) || (end != "" && x.key >= end) {
+			break
+		}
+		deadline, hasTTL := k.expires[x.key]
+		if hasTTL && !now.Before(deadline) {
+			continue
+		}
+		if limit > 0 && len(kvs) == limit {
+			return kvs, x.key, nil
+		}
+
+		e := k.m[x.key]
+		kvs = append(kvs, KeyValue{Key: x.key, Value: e.value, Version: e.version, ExpiresAt: deadline})
+	}
+
+	return kvs, "", nil
+}
+
+// Snapshot returns every live key in ascending order
+func (k *KVStore) Snapshot() []KeyValue {
+	k.RLock()
+	defer k.RUnlock()
+
+	now := time.Now()
+	kvs := make([]KeyValue, 0, len(k.m))
+	for x := k.index.seek(""); x != nil; x = x.next[0] {
+		deadline, hasTTL := k.expires[x.key]
+		if hasTTL && !now.Before(deadline) {
+			continue
+		}
+
+		e := k.m[x.key]
+		kvs = append(kvs, KeyValue{Key: x.key, Value: e.value, Version: e.version, ExpiresAt: deadline})
+	}
+
+	return kvs
+}
+
+// Lookup returns the live key with its deadline, version 0 if it is absent
+func (k *KVStore) Lookup(key string) KeyValue {
+	k.RLock()
+	defer k.RUnlock()
+
+	e, ok := k.m[key]
+	deadline, hasTTL := k.expires[key]
+	if !ok || (hasTTL && !time.Now().Before(deadline)) {
+		return KeyValue{Key: key}
+	}
+	return KeyValue{Key: key, Value: e.value, Version: e.version, ExpiresAt: deadline}
+}
+
+// Revert sets the key back to what Lookup returned, even to a lower
+// version, version 0 deletes the key. The revision is kept, so the
+// version of the reverted write is not given again
+func (k *KVStore) Revert(kv KeyValue) {
+	k.Lock()
+	defer k.Unlock()
+
+	if kv.Version == 0 || (!kv.ExpiresAt.IsZero() && !time.Now().Before(kv.ExpiresAt)) {
+		k.deleteLocked(kv.Key)
+		return
+	}
+
+	k.setLocked(kv.Key, entry{value: kv.Value, version: kv.Version})
+	if kv.ExpiresAt.IsZero() {
+		delete(k.expires, kv.Key)
+	} else {
+		k.expires[kv.Key] = kv.ExpiresAt
+	}
+}
+
+// Expired returns the keys whose deadline has passed
+func (k *KVStore) Expired() []string {
+	k.RLock()
+	defer k.RUnlock()
+
+	now := time.Now()
+	var keys []string
+	for key, deadline := range k.expires {
+		if !now.Before(deadline) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Expire removes the key if its deadline has passed
+// and returns the version it was removed at
+func (k *KVStore) Expire(key string) (uint64, bool) {
+	k.Lock()
+	defer k.Unlock()
+
+	version := k.m[key].version
+	if !k.expireLocked(key, time.Now()) {
+		return 0, false
+	}
+	return version, true
+}
+
+// Stats returns the number of keys and the sum of their key and value
+// lengths, keys which expired but were not reaped yet are counted
+func (k *KVStore) Stats() (keys int, bytes int64) {
+	k.RLock()
+	defer k.RUnlock()
+	return len(k.m), k.bytes
+}
+
+// putLocked writes the key at the next revision,
+// the caller must hold the write lock
+func (k *KVStore) putLocked(key, value string, ttl time.Duration, now time.Time) uint64 {
+	k.revision++
+	version := k.revision
+	k.setLocked(key, entry{value: value, version: version})
+	if ttl > 0 {
+		k.expires[key] = now.Add(ttl)
+	} else {
+		delete(k.expires, key)
+	}
+
+	return version
+}
+
+// lookupLocked returns the live entry of the key, an expired
+// key is left for the reaper, the caller must hold the lock
+func (k *KVStore) lookupLocked(key string, now time.Time) (entry, bool) {
+	deadline, hasTTL := k.expires[key]
+	if hasTTL && !now.Before(deadline) {
+		return entry{}, false
+	}
+
+	e, ok := k.m[key]
+	return e, ok
+}
+
+func (k *KVStore) setLocked(key string, e entry) {
+	if old, ok := k.m[key]; ok {
+		k.bytes -= int64(len(old.value))
+	} else {
+		k.bytes += int64(len(key))
+	}
+	k.bytes += int64(len(e.value))
+	k.m[key] = e
+	k.index.insert(key)
+}
+
+func (k *KVStore) deleteLocked(key string) {
+	if old, ok := k.m[key]; ok {
+		k.bytes -= int64(len(key) + len(old.value))
+	}
 	delete(k.m, key)
-	return val, nil
+	delete(k.expires, key)
+	k.index.remove(key)
+}
+
+// expireLocked deletes the key if its deadline has passed,
+// the caller must hold the write lock
+func (k *KVStore) expireLocked(key string, now time.Time) bool {
+	deadline, ok := k.expires[key]
+	if !ok || now.Before(deadline) {
+		return false
+	}
+
+	k.deleteLocked(key)
+	return true
 }
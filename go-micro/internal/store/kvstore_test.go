@@ -1,7 +1,11 @@
 package store
 
 import (
+	"go-micro/utils"
+	"math/rand/v2"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -12,8 +16,9 @@ func TestKVStore(t *testing.T) {
 
 	t.Run("test put", func(t *testing.T) {
 		key, val := "hello", "world"
-		err := kvstore.Put(key, val)
+		version, err := kvstore.Put(key, val)
 		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), version)
 	})
 
 	t.Run("test get", func(t *testing.T) {
@@ -38,7 +43,7 @@ func TestKVStore(t *testing.T) {
 		}
 
 		for _, tc := range testcases {
-			value, err := kvstore.Get(tc.key)
+			value, _, err := kvstore.Get(tc.key)
 			if tc.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -69,7 +74,7 @@ func TestKVStore(t *testing.T) {
 		}
 
 		for _, tc := range testcases {
-			_, err := kvstore.Del(tc.key)
+			_, _, err := kvstore.Del(tc.key)
 
 			if tc.wantErr {
 				assert.Error(t, err)
@@ -79,3 +84,399 @@ func TestKVStore(t *testing.T) {
 		}
 	})
 }
+
+func TestKVStoreTTL(t *testing.T) {
+	kvstore := NewKVStore()
+
+	t.Run("test get before and after expiry", func(t *testing.T) {
+		_, err := kvstore.PutWithTTL("session", "token", 50*time.Millisecond)
+		assert.NoError(t, err)
+
+		value, _, err := kvstore.Get("session")
+		assert.NoError(t, err)
+		assert.Equal(t, "token", value)
+
+		time.Sleep(60 * time.Millisecond)
+		_, _, err = kvstore.Get("session")
+		assert.ErrorIs(t, err, ErrorNoSuchKey)
+
+		_, _, err = kvstore.Del("session")
+		assert.ErrorIs(t, err, ErrorNoSuchKey)
+
+		// the expired key is left for the reaper to remove and log
+		keys, _ := kvstore.Stats()
+		assert.Equal(t, 1, keys)
+	})
+
+	t.Run("test put clears ttl", func(t *testing.T) {
+		_, err := kvstore.PutWithTTL("hello", "world", 10*time.Millisecond)
+		assert.NoError(t, err)
+		_, err = kvstore.Put("hello", "world")
+		assert.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+		value, _, err := kvstore.Get("hello")
+		assert.NoError(t, err)
+		assert.Equal(t, "world", value)
+	})
+
+	t.Run("test expire", func(t *testing.T) {
+		version, err := kvstore.PutWithTTL("reaped", "value", 10*time.Millisecond)
+		assert.NoError(t, err)
+
+		_, ok := kvstore.Expire("reaped")
+		assert.False(t, ok)
+
+		// the session read after its expiry is expired as well
+		time.Sleep(20 * time.Millisecond)
+		keys := kvstore.Expired()
+		slices.Sort(keys)
+		assert.Equal(t, []string{"reaped", "session"}, keys)
+
+		expired, ok := kvstore.Expire("reaped")
+		assert.True(t, ok)
+		assert.Equal(t, version, expired)
+		expired, ok = kvstore.Expire("session")
+		assert.True(t, ok)
+		assert.Equal(t, uint64(1), expired)
+
+		_, ok = kvstore.Expire("reaped")
+		assert.False(t, ok)
+		assert.Empty(t, kvstore.Expired())
+	})
+}
+
+func TestKVStoreVersions(t *testing.T) {
+	kvstore := NewKVStore()
+
+	t.Run("test versions", func(t *testing.T) {
+		version, err := kvstore.Put("hello", "world")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), version)
+
+		version, err = kvstore.Put("hello", "there")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), version)
+
+		_, version, err = kvstore.Get("hello")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(2), version)
+	})
+
+	t.Run("test compare and swap", func(t *testing.T) {
+		testcases := []struct {
+			name        string
+			key         string
+			version     uint64
+			wantVersion uint64
+			wantErr     error
+		}{
+			{
+				name:        "matching version",
+				key:         "hello",
+				version:     2,
+				wantVersion: 3,
+			}, {
+				name:        "stale version",
+				key:         "hello",
+				version:     2,
+				wantVersion: 3,
+				wantErr:     ErrorVersionMismatch,
+			}, {
+				name:        "absent key",
+				key:         "world",
+				version:     0,
+				wantVersion: 4,
+			},
+		}
+
+		for _, tc := range testcases {
+			version, err := kvstore.CompareAndSwap(tc.key, "value", tc.version, 0)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr, tc.name)
+			} else {
+				assert.NoError(t, err, tc.name)
+			}
+			assert.Equal(t, tc.wantVersion, version, tc.name)
+		}
+	})
+
+	t.Run("test put if absent", func(t *testing.T) {
+		version, err := kvstore.PutIfAbsent("lock", "owner", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(5), version)
+
+		_, err = kvstore.PutIfAbsent("lock", "thief", 0)
+		assert.ErrorIs(t, err, ErrorKeyExists)
+	})
+
+	t.Run("test delete if version", func(t *testing.T) {
+		_, err := kvstore.DelIfVersion("lock", 4)
+		assert.ErrorIs(t, err, ErrorVersionMismatch)
+
+		value, err := kvstore.DelIfVersion("lock", 5)
+		assert.NoError(t, err)
+		assert.Equal(t, "owner", value)
+
+		_, err = kvstore.DelIfVersion("lock", 5)
+		assert.ErrorIs(t, err, ErrorNoSuchKey)
+	})
+
+	t.Run("test versions survive deletes", func(t *testing.T) {
+		first, err := kvstore.Put("cycled", "first")
+		assert.NoError(t, err)
+		_, _, err = kvstore.Del("cycled")
+		assert.NoError(t, err)
+		second, err := kvstore.Put("cycled", "second")
+		assert.NoError(t, err)
+		assert.Greater(t, second, first)
+
+		// a version of the deleted key does not match the new one
+		_, err = kvstore.CompareAndSwap("cycled", "stale", first, 0)
+		assert.ErrorIs(t, err, ErrorVersionMismatch)
+		_, err = kvstore.DelIfVersion("cycled", first)
+		assert.ErrorIs(t, err, ErrorVersionMismatch)
+		assert.NoError(t, kvstore.RestoreDel("cycled", first))
+		value, _, err := kvstore.Get("cycled")
+		assert.NoError(t, err)
+		assert.Equal(t, "second", value)
+	})
+
+	t.Run("test restore", func(t *testing.T) {
+		err := kvstore.Restore("restored", "value", 7, time.Time{})
+		assert.NoError(t, err)
+
+		_, version, err := kvstore.Get("restored")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(7), version)
+
+		// logs without versions take the next revision
+		err = kvstore.Restore("restored", "value", 0, time.Time{})
+		assert.NoError(t, err)
+
+		_, version, err = kvstore.Get("restored")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(8), version)
+
+		// a put logged out of order does not roll the key back
+		err = kvstore.Restore("restored", "stale", 5, time.Time{})
+		assert.NoError(t, err)
+		value, version, err := kvstore.Get("restored")
+		assert.NoError(t, err)
+		assert.Equal(t, "value", value)
+		assert.Equal(t, uint64(8), version)
+	})
+
+	t.Run("test revert", func(t *testing.T) {
+		old, _ := kvstore.PutWithTTL("reverted", "old", time.Hour)
+		prev := kvstore.Lookup("reverted")
+		assert.Equal(t, "old", prev.Value)
+		assert.Equal(t, old, prev.Version)
+		assert.False(t, prev.ExpiresAt.IsZero())
+
+		reverted, _ := kvstore.Put("reverted", "new")
+		kvstore.Revert(prev)
+		assert.Equal(t, prev, kvstore.Lookup("reverted"))
+
+		// the version of the reverted write is not given again
+		version, _ := kvstore.Put("reverted", "newer")
+		assert.Greater(t, version, reverted)
+
+		// an absent key is deleted again
+		absent := kvstore.Lookup("never-written")
+		assert.Equal(t, uint64(0), absent.Version)
+		kvstore.Put("never-written", "new")
+		kvstore.Revert(absent)
+		_, _, err := kvstore.Get("never-written")
+		assert.ErrorIs(t, err, ErrorNoSuchKey)
+	})
+
+	t.Run("test restore del", func(t *testing.T) {
+		testcases := []struct {
+			name    string
+			version uint64
+			deleted bool
+		}{
+			{name: "older version", version: 2, deleted: false},
+			{name: "newer version", version: 4, deleted: false},
+			{name: "same version", version: 3, deleted: true},
+			{name: "any version", version: 0, deleted: true},
+		}
+
+		for _, tc := range testcases {
+			kvstore.Restore("restored-del", "value", 3, time.Time{})
+			err := kvstore.RestoreDel("restored-del", tc.version)
+			assert.NoError(t, err, tc.name)
+
+			_, _, err = kvstore.Get("restored-del")
+			if tc.deleted {
+				assert.ErrorIs(t, err, ErrorNoSuchKey, tc.name)
+				continue
+			}
+			assert.NoError(t, err, tc.name)
+			kvstore.RestoreDel("restored-del", 0)
+		}
+	})
+}
+
+func TestKVStoreScan(t *testing.T) {
+	kvstore := NewKVStore()
+	for _, key := range []string{"user/3", "user/1", "app/a", "user/2", "zone", "user/4"} {
+		_, err := kvstore.Put(key, "v-"+key)
+		assert.NoError(t, err)
+	}
+	_, _, err := kvstore.Del("user/4")
+	assert.NoError(t, err)
+
+	testcases := []struct {
+		name     string
+		prefix   string
+		start    string
+		end      string
+		limit    int
+		wantKeys []string
+		wantNext string
+	}{
+		{
+			name:     "all keys",
+			wantKeys: []string{"app/a", "user/1", "user/2", "user/3", "zone"},
+		}, {
+			name:     "prefix",
+			prefix:   "user/",
+			wantKeys: []string{"user/1", "user/2", "user/3"},
+		}, {
+			name:     "range",
+			start:    "user/2",
+			end:      "zone",
+			wantKeys: []string{"user/2", "user/3"},
+		}, {
+			name:     "first page",
+			prefix:   "user/",
+			limit:    2,
+			wantKeys: []string{"user/1", "user/2"},
+			wantNext: "user/3",
+		}, {
+			name:     "last page",
+			prefix:   "user/",
+			start:    "user/3",
+			limit:    2,
+			wantKeys: []string{"user/3"},
+		},
+	}
+
+	for _, tc := range testcases {
+		kvs, next, err := kvstore.Scan(tc.prefix, tc.start, tc.end, tc.limit)
+		assert.NoError(t, err, tc.name)
+
+		keys := make([]string, 0, len(kvs))
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+			assert.Equal(t, "v-"+kv.Key, kv.Value, tc.name)
+		}
+		assert.Equal(t, tc.wantKeys, keys, tc.name)
+		assert.Equal(t, tc.wantNext, next, tc.name)
+	}
+
+	t.Run("test index stays sorted", func(t *testing.T) {
+		kvstore := NewKVStore()
+		want := make(map[string]bool)
+		for range 2000 {
+			key := utils.RandomString(rand.IntN(3) + 1)
+			if rand.IntN(3) == 0 {
+				kvstore.Del(key)
+				delete(want, key)
+			} else {
+				kvstore.Put(key, key)
+				want[key] = true
+			}
+		}
+
+		wantKeys := make([]string, 0, len(want))
+		for key := range want {
+			wantKeys = append(wantKeys, key)
+		}
+		slices.Sort(wantKeys)
+
+		kvs, _, err := kvstore.Scan("", "", "", 0)
+		assert.NoError(t, err)
+
+		keys := make([]string, 0, len(kvs))
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		assert.Equal(t, wantKeys, keys)
+	})
+}
+
+func TestKVStoreBatch(t *testing.T) {
+	kvstore := NewKVStore()
+	_, err := kvstore.Put("user/1", "alice")
+	assert.NoError(t, err)
+
+	t.Run("test batch applies all ops", func(t *testing.T) {
+		results, err := kvstore.Batch([]Op{
+			{Type: OpPut, Key: "user/1", Value: "bob", CheckVersion: true, Version: 1},
+			{Type: OpPut, Key: "index/bob", Value: "user/1", CheckVersion: true, Version: 0},
+			{Type: OpPut, Key: "index/bob", Value: "user/1"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []KeyValue{
+			{Key: "user/1", Value: "bob", Version: 2},
+			{Key: "index/bob", Value: "user/1", Version: 3},
+			{Key: "index/bob", Value: "user/1", Version: 4},
+		}, results)
+	})
+
+	t.Run("test failing op leaves store untouched", func(t *testing.T) {
+		testcases := []struct {
+			name    string
+			ops     []Op
+			wantErr error
+		}{
+			{
+				name: "version mismatch",
+				ops: []Op{
+					{Type: OpDelete, Key: "user/1"},
+					{Type: OpPut, Key: "index/bob", Value: "gone", CheckVersion: true, Version: 1},
+				},
+				wantErr: ErrorVersionMismatch,
+			}, {
+				name: "delete of a key deleted earlier in the batch",
+				ops: []Op{
+					{Type: OpDelete, Key: "user/1"},
+					{Type: OpDelete, Key: "user/1"},
+				},
+				wantErr: ErrorNoSuchKey,
+			},
+		}
+
+		for _, tc := range testcases {
+			_, err := kvstore.Batch(tc.ops)
+			assert.ErrorIs(t, err, tc.wantErr, tc.name)
+
+			value, version, err := kvstore.Get("user/1")
+			assert.NoError(t, err, tc.name)
+			assert.Equal(t, "bob", value, tc.name)
+			assert.Equal(t, uint64(2), version, tc.name)
+		}
+	})
+}
+
+func TestKVStoreStats(t *testing.T) {
+	kvstore := NewKVStore()
+
+	kvstore.Put("a", "12345")
+	kvstore.Put("bb", "1")
+	kvstore.Put("a", "123")
+	keys, bytes := kvstore.Stats()
+	assert.Equal(t, 2, keys)
+	assert.Equal(t, int64(len("a123")+len("bb1")), bytes)
+
+	kvstore.Del("a")
+	_, err := kvstore.Batch([]Op{{Type: OpPut, Key: "c", Value: "xy"}, {Type: OpDelete, Key: "bb"}})
+	assert.NoError(t, err)
+	kvstore.Restore("d", "v", 3, time.Time{})
+	keys, bytes = kvstore.Stats()
+	assert.Equal(t, 2, keys)
+	assert.Equal(t, int64(len("cxy")+len("dv")), bytes)
+}
@@ -0,0 +1,100 @@
+package store
+
+import "math/rand/v2"
+
+const (
+	maxLevel = 32
+	pLevel   = 0.25 // probability of promoting a node to the next level
+)
+
+type skipNode struct {
+	key  string
+	next []*skipNode
+}
+
+// skiplist keeps the keys of the store in sorted order,
+// it is not safe for concurrent use and relies on the store's lock
+type skiplist struct {
+	head  *skipNode
+	level int
+	len   int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skipNode{next: make([]*skipNode, maxLevel)},
+		level: 1,
+	}
+}
+
+// insert adds the key, inserting an existing key is a no-op
+func (s *skiplist) insert(key string) {
+	var update [maxLevel]*skipNode
+	x := s.search(key, &update)
+	if x != nil && x.key == key {
+		return
+	}
+
+	lvl := randomLevel()
+	if lvl > s.level {
+		for i := s.level; i < lvl; i++ {
+			update[i] = s.head
+		}
+		s.level = lvl
+	}
+
+	node := &skipNode{key: key, next: make([]*skipNode, lvl)}
+	for i := range lvl {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	s.len++
+}
+
+// remove deletes the key, removing a missing key is a no-op
+func (s *skiplist) remove(key string) {
+	var update [maxLevel]*skipNode
+	x := s.search(key, &update)
+	if x == nil || x.key != key {
+		return
+	}
+
+	for i := range s.level {
+		if update[i].next[i] != x {
+			break
+		}
+		update[i].next[i] = x.next[i]
+	}
+
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.len--
+}
+
+// seek returns the first node with a key >= key or nil
+func (s *skiplist) seek(key string) *skipNode {
+	var update [maxLevel]*skipNode
+	return s.search(key, &update)
+}
+
+// search fills update with the last node before key on every level
+// and returns the first node with a key >= key
+func (s *skiplist) search(key string, update *[maxLevel]*skipNode) *skipNode {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+	return x.next[0]
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < maxLevel && rand.Float64() < pLevel {
+		lvl++
+	}
+	return lvl
+}
@@ -2,15 +2,88 @@ package store
 
 import (
 	"errors"
+	"time"
 )
 
 // globals
 
-// basic key value store interface
+// basic key value store interface,
+// every write gives its key the next revision of the store as version,
+// revisions only grow, also over deletes, so a version is never given
+// to two writes, absent keys have version 0
 type Store interface {
-	Put(string, string) error
-	Get(string) (string, error)
-	Del(string) (string, error)
+	Put(string, string) (uint64, error)
+	PutWithTTL(string, string, time.Duration) (uint64, error) // key expires once ttl has elapsed
+	Get(string) (string, uint64, error)
+	Del(string) (string, uint64, error)
+
+	// conditional writes, a ttl of 0 means the key never expires
+	CompareAndSwap(key, value string, version uint64, ttl time.Duration) (uint64, error)
+	PutIfAbsent(key, value string, ttl time.Duration) (uint64, error)
+	DelIfVersion(key string, version uint64) (string, error)
+
+	// Restore writes the key with the given version while replaying the log,
+	// unless the key is already at or past it, version 0 takes the next
+	// revision like a plain put
+	Restore(key, value string, version uint64, expiresAt time.Time) error
+	// RestoreDel removes the key while replaying the log if it is
+	// at the given version, version 0 removes it at any version
+	RestoreDel(key string, version uint64) error
+
+	// Revision returns the version the last write got, RestoreRevision
+	// raises it to the one of a snapshot, the versions of the keys
+	// deleted before the snapshot are not given again
+	Revision() uint64
+	RestoreRevision(revision uint64)
+
+	// Scan returns at most limit keys in ascending order which have the prefix
+	// and lie in [start, end), an empty end means no upper bound,
+	// next is the key to resume the scan from or "" once it is exhausted
+	Scan(prefix, start, end string, limit int) (kvs []KeyValue, next string, err error)
+
+	// Batch applies all ops in order or none of them if any op fails,
+	// returning the key, value and version each op left behind
+	Batch(ops []Op) ([]KeyValue, error)
+
+	// Snapshot returns every live key, used to snapshot the store
+	Snapshot() []KeyValue
+
+	// Lookup returns the live key with its deadline, version 0 if it is absent,
+	// Revert sets the key back to what Lookup returned before
+	// a write which could not be logged
+	Lookup(key string) KeyValue
+	Revert(kv KeyValue)
+
+	// Expired returns the keys whose deadline has passed, Expire removes
+	// the key if it is still expired and returns the version it removed
+	Expired() []string
+	Expire(key string) (version uint64, ok bool)
 }
 
-var ErrorNoSuchKey = errors.New("no such key")
+const (
+	OpPut int = iota
+	OpDelete
+)
+
+// Op is a single write of a batch
+type Op struct {
+	Type         int
+	Key          string
+	Value        string
+	TTL          time.Duration // ttl of a put, 0 means the key never expires
+	CheckVersion bool          // only apply the op if the key is at Version
+	Version      uint64        // expected version, 0 expects the key to be absent
+}
+
+type KeyValue struct {
+	Key       string
+	Value     string
+	Version   uint64
+	ExpiresAt time.Time // zero if the key never expires
+}
+
+var (
+	ErrorNoSuchKey       = errors.New("no such key")
+	ErrorKeyExists       = errors.New("key already exists")
+	ErrorVersionMismatch = errors.New("version mismatch")
+)
@@ -0,0 +1,84 @@
+package transactionLogger
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// watcherBuffer is the number of events a watcher may lag behind
+// before it is dropped
+const watcherBuffer = 256
+
+// broadcaster fans the events written by a logger out to its watchers,
+// it is embedded by the loggers and usable as zero value
+type broadcaster struct {
+	mu       sync.Mutex
+	watchers map[chan Event]struct{}
+}
+
+// Subscribe returns a channel receiving every event written from now on,
+// the channel is closed if the watcher falls too far behind
+// or once the returned function is called
+func (b *broadcaster) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, watcherBuffer)
+
+	b.mu.Lock()
+	if b.watchers == nil {
+		b.watchers = make(map[chan Event]struct{})
+	}
+	b.watchers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() { b.drop(ch) })
+	}
+}
+
+// publish hands a written event to every watcher without blocking the writer
+func (b *broadcaster) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.watchers {
+		select {
+		case ch <- e:
+		default:
+			// slow watcher, it has to resume from the log
+			delete(b.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// dropWatchers closes the channel of every watcher, they
+// resume from the logger which replaces this one
+func (b *broadcaster) dropWatchers() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.watchers {
+		delete(b.watchers, ch)
+		close(ch)
+	}
+}
+
+func (b *broadcaster) drop(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.watchers[ch]; ok {
+		delete(b.watchers, ch)
+		close(ch)
+	}
+}
+
+// storeMaxUint64 raises addr to val unless it already holds a bigger value
+func storeMaxUint64(addr *uint64, val uint64) {
+	for {
+		cur := atomic.LoadUint64(addr)
+		if cur >= val || atomic.CompareAndSwapUint64(addr, cur, val) {
+			return
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package transactionLogger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// compactFile rewrites the log in the current format keeping only the events
+// after upTo, preceded by an EventCompacted marker carrying upTo as its id unless
+// it is 0, the new log atomically replaces the old one and is returned opened for appending
+func compactFile(old *os.File, upTo uint64, read func() (<-chan Event, <-chan error), write func(io.Writer, Event) error) (*os.File, error) {
+	name := old.Name()
+	tmpname := name + ".compact"
+
+	tmp, err := os.OpenFile(tmpname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating file %s: %s", tmpname, err)
+	}
+	defer os.Remove(tmpname)
+
+	writer := bufio.NewWriter(tmp)
+	_, err = io.WriteString(writer, fileFormatHeader)
+	if err == nil && upTo > 0 {
+		err = write(writer, Event{Id: upTo, EventType: EventCompacted})
+	}
+
+	// drain the reader even after a failed write
+	events, errors := read()
+	for e := range events {
+		if err != nil || e.Id <= upTo {
+			continue
+		}
+		err = write(writer, e)
+	}
+	if readErr := <-errors; err == nil {
+		err = readErr
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error compacting %s: %s", name, err)
+	}
+
+	if err := os.Rename(tmpname, name); err != nil {
+		return nil, fmt.Errorf("error replacing %s: %s", name, err)
+	}
+
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %s", name, err)
+	}
+
+	old.Close()
+	return file, nil
+}
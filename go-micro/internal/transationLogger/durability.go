@@ -0,0 +1,389 @@
+package transactionLogger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type SyncMode int
+
+const (
+	SyncNone     SyncMode = iota // leave flushing the file to the os
+	SyncInterval                 // fsync the file every SyncPolicy.Interval
+	SyncAlways                   // fsync the file before a write is published
+)
+
+// SyncPolicy decides when written events are fsynced, in SyncAlways mode the
+// events queued up while the file is synced are committed by the next single fsync,
+// the policy also decides when a waiting write is durable, in SyncNone and
+// SyncInterval mode that is once the os has it, so a crash of the machine
+// may lose it but a crash of the process may not
+type SyncPolicy struct {
+	Mode     SyncMode
+	Interval time.Duration
+}
+
+var DefaultSyncPolicy = SyncPolicy{Mode: SyncInterval, Interval: 100 * time.Millisecond}
+
+// maxGroupCommit bounds the events written ahead of a single fsync
+const maxGroupCommit = 256
+
+func (s SyncPolicy) Validate() error {
+	switch s.Mode {
+	case SyncNone, SyncAlways:
+		return nil
+	case SyncInterval:
+		if s.Interval <= 0 {
+			return fmt.Errorf("sync interval must be positive, got %s", s.Interval)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown sync mode %d", s.Mode)
+	}
+}
+
+// pendingEvent is an event queued for the writer, done receives
+// the outcome once the event is durable unless it is nil, span
+// is the log.append span of the waiting write
+type pendingEvent struct {
+	Event
+	done chan<- error
+	span trace.Span
+}
+
+// ErrLoggerClosed rejects writes after Close
+var ErrLoggerClosed = errors.New("transaction logger closed")
+
+// ErrNotSynced reports a write which reached the log before the writer gave up,
+// it is replayed unless a crash of the machine loses it, so the store keeps it
+// rather than reverting it, the writes which did not reach the log get the
+// error of the writer itself
+var ErrNotSynced = errors.New("write logged but not synced")
+
+// rolledBackError wraps the error of a writer which left none of the events
+// of its group in the log, as a rolled back transaction does
+type rolledBackError struct {
+	err error
+}
+
+func (e rolledBackError) Error() string { return e.err.Error() }
+
+func (e rolledBackError) Unwrap() error { return e.err }
+
+// writeQueue hands the events to the writer go routine,
+// it is embedded by the loggers and started by their Run
+type writeQueue struct {
+	backend string
+	events  chan pendingEvent
+	errors  chan error
+	stopped chan struct{} // closed once the writer returned
+	err     error         // why the writer gave up, set before stopped is closed
+
+	// held for sending so events is not closed underneath, the channels
+	// are set by start while the metrics may already read the queue
+	mu     sync.RWMutex
+	closed bool
+}
+
+// start runs the writer, backend labels its metrics and spans
+func (q *writeQueue) start(backend string, policy SyncPolicy, write func(Event) (Event, error), sync func() error, publish func(Event)) {
+	q.mu.Lock()
+	q.backend = backend
+	q.events = make(chan pendingEvent, 16)
+	q.errors = make(chan error, 1)
+	q.stopped = make(chan struct{})
+	events := q.events
+	q.mu.Unlock()
+	metrics := newWriterMetrics(backend)
+
+	go func() {
+		err := runWriter(events, policy, write, sync, publish, metrics)
+		q.err = err
+		close(q.stopped)
+		if err != nil {
+			q.errors <- err
+		}
+	}()
+}
+
+// enqueue queues the event without waiting for it to be written,
+// the event is dropped once the logger is closed or stopped
+func (q *writeQueue) enqueue(e Event) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		slog.Warn("dropping event", "key", e.Key, "err", ErrLoggerClosed)
+		return
+	}
+
+	select {
+	case q.events <- pendingEvent{Event: e}:
+	case <-q.stopped:
+	}
+}
+
+// enqueueWait queues the event and waits until it is durable,
+// tracing the wait as a child span of ctx
+func (q *writeQueue) enqueueWait(ctx context.Context, e Event) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	q.mu.RLock()
+	backend := q.backend
+	q.mu.RUnlock()
+
+	ctx, span := startAppendSpan(ctx, backend, e)
+	defer func() { endSpan(span, err) }()
+
+	done := make(chan error, 1)
+	if err := q.send(ctx, pendingEvent{Event: e, done: done, span: span}); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-q.stopped:
+		// the writer may have answered before it gave up
+		select {
+		case err := <-done:
+			return err
+		default:
+			return q.stoppedError()
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *writeQueue) send(ctx context.Context, pending pendingEvent) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrLoggerClosed
+	}
+
+	select {
+	case q.events <- pending:
+		return nil
+	case <-q.stopped:
+		return q.stoppedError()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close stops taking events and waits until the queued ones are written
+// and synced, returning the error the writer gave up on if any
+func (q *writeQueue) close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed || q.events == nil {
+		q.closed = true
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.events)
+	q.mu.Unlock()
+
+	select {
+	case <-q.stopped:
+		return q.err
+	case <-ctx.Done():
+		return fmt.Errorf("error draining events: %w", ctx.Err())
+	}
+}
+
+// writerDone tells if the writer returned or never ran,
+// only then may the log be released
+func (q *writeQueue) writerDone() bool {
+	if q.stopped == nil {
+		return true
+	}
+	select {
+	case <-q.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Writable returns why writes are refused, nil while they are logged
+func (q *writeQueue) Writable() error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrLoggerClosed
+	}
+	if q.stopped != nil {
+		select {
+		case <-q.stopped:
+			return q.stoppedError()
+		default:
+		}
+	}
+	return nil
+}
+
+func (q *writeQueue) WritePutContext(ctx context.Context, key, value string, version uint64, expiresAt time.Time) error {
+	e := Event{EventType: EventPut, Key: key, Value: value, Version: version}
+	if !expiresAt.IsZero() {
+		e.ExpiresAt = expiresAt.UnixNano()
+	}
+	return q.enqueueWait(ctx, e)
+}
+
+func (q *writeQueue) WriteDelContext(ctx context.Context, key string, version uint64) error {
+	return q.enqueueWait(ctx, Event{EventType: EventDelete, Key: key, Version: version})
+}
+
+func (q *writeQueue) WriteBatchContext(ctx context.Context, events []Event) error {
+	return q.enqueueWait(ctx, Event{EventType: EventBatch, Batch: events})
+}
+
+func (q *writeQueue) stoppedError() error {
+	if q.err != nil {
+		return fmt.Errorf("transaction logger stopped: %s", q.err)
+	}
+	return errors.New("transaction logger stopped")
+}
+
+func (q *writeQueue) Err() <-chan error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.errors
+}
+
+func (q *writeQueue) QueueDepth() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return len(q.events)
+}
+
+// runWriter writes the events in groups of whatever queued up,
+// syncs them according to the policy and publishes them afterwards,
+// the waiting writers are answered after the sync the policy asks for,
+// it returns the error it gave up on, metrics may be nil,
+// the events of the group written before it gave up get ErrNotSynced
+func runWriter(events <-chan pendingEvent, policy SyncPolicy,
+	write func(Event) (Event, error), sync func() error, publish func(Event), metrics *writerMetrics) error {
+
+	if metrics != nil {
+		write, sync = metrics.timeWrite(write), metrics.timeSync(sync)
+	}
+
+	var tick <-chan time.Time
+	if policy.Mode == SyncInterval {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var dirty bool
+	group := make([]pendingEvent, 0, maxGroupCommit)
+	fail := func(err error) error {
+		var rolledBack rolledBackError
+		lost := errors.As(err, &rolledBack)
+		for _, pending := range group {
+			if pending.done == nil {
+				continue
+			}
+			if lost {
+				pending.done <- err
+			} else {
+				pending.done <- fmt.Errorf("%w: %s", ErrNotSynced, err)
+			}
+		}
+		return err
+	}
+
+	for {
+		select {
+		case <-tick:
+			if !dirty {
+				continue
+			}
+			if err := sync(); err != nil {
+				return fmt.Errorf("error syncing log: %s", err)
+			}
+			dirty = false
+
+		case pending, ok := <-events:
+			flushStart := time.Now()
+			closed := !ok
+			group = group[:0]
+			for ok {
+				written, err := write(pending.Event)
+				switch {
+				case errors.Is(err, ErrRecordTooLarge):
+					// nothing was written, only this event is rejected
+					if pending.done != nil {
+						pending.done <- err
+					} else {
+						slog.Warn("dropping event", "key", pending.Key, "err", err)
+					}
+				case err != nil:
+					// a failed write leaves at most a torn record, which is cut off
+					// when the log is opened again, so only this event is lost
+					if pending.done != nil {
+						pending.done <- err
+					}
+					return fail(err)
+				default:
+					group = append(group, pendingEvent{Event: written, done: pending.done, span: pending.span})
+					if pending.span != nil {
+						pending.span.AddEvent("written", trace.WithAttributes(attribute.Int64("kv.event.id", int64(written.Id))))
+					}
+				}
+
+				if len(group) == maxGroupCommit {
+					break
+				}
+				select {
+				case pending, ok = <-events:
+					closed = !ok
+				default:
+					ok = false
+				}
+			}
+
+			dirty = dirty || len(group) > 0
+			// a closed queue is synced whatever the policy
+			if dirty && (policy.Mode == SyncAlways || closed) {
+				if err := sync(); err != nil {
+					return fail(fmt.Errorf("error syncing log: %w", err))
+				}
+				dirty = false
+			}
+
+			for _, written := range group {
+				if written.span != nil {
+					written.span.AddEvent("synced", trace.WithAttributes(attribute.Int("kv.group.size", len(group))))
+				}
+				if written.done != nil {
+					written.done <- nil
+				}
+				publish(written.Event)
+			}
+			if metrics != nil && len(group) > 0 {
+				observeSince(metrics.flush, flushStart)
+			}
+			if closed {
+				return nil
+			}
+		}
+	}
+}
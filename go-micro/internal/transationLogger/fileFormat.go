@@ -0,0 +1,243 @@
+package transactionLogger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// fileFormatHeader is the first line of a log whose keys and values are quoted,
+// logs without it were written before and hold them verbatim
+const fileFormatHeader = "#kvlog 2\n"
+
+// maxFileLineBytes bounds a line of an event of up to maxRecordBytes,
+// a quoted value takes up to four bytes for every byte of it
+func maxFileLineBytes(maxRecordBytes int) int {
+	return 4*maxRecordBytes + 1024
+}
+
+// upgradeFormat writes the format header to a new log
+// and rewrites a log of the legacy format
+func (f *FileTransactionLogger) upgradeFormat() error {
+	head := make([]byte, len(fileFormatHeader))
+	n, err := f.file.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading file %s: %s", f.filename, err)
+	}
+
+	switch {
+	case string(head[:n]) == fileFormatHeader:
+		return nil
+	case strings.HasPrefix(fileFormatHeader, string(head[:n])):
+		// a new log, or one whose header was torn
+		if err := f.file.Truncate(0); err != nil {
+			return fmt.Errorf("error truncating file %s: %s", f.filename, err)
+		}
+		if _, err := io.WriteString(f.file, fileFormatHeader); err != nil {
+			return fmt.Errorf("error writing file header %s: %s", f.filename, err)
+		}
+		return nil
+	}
+
+	file, err := compactFile(f.file, 0, f.ReadEvents, writeFileRecord)
+	if err != nil {
+		return fmt.Errorf("error upgrading legacy log: %s", err)
+	}
+	f.file = file
+	return nil
+}
+
+// readFileEvents calls fn for every event of the first size bytes of the log
+// and returns the offset following the last complete one, a final line
+// without its newline or a batch missing entries yields ErrTornRecord
+func readFileEvents(r io.ReaderAt, size int64, maxRecordBytes int, fn func(Event) error) (int64, error) {
+	scanner := bufio.NewScanner(io.NewSectionReader(r, 0, size))
+	scanner.Buffer(nil, maxFileLineBytes(maxRecordBytes))
+
+	// files without the format header hold legacy lines
+	parse := parseLegacyFileEvent
+
+	var end int64    // end of the last complete event
+	var offset int64 // end of the line read last
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		offset += int64(len(scanner.Bytes())) + 1
+		return scanner.Text(), true
+	}
+	scanErr := func() error {
+		if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+			return fmt.Errorf("%w: line after offset %d is longer than %d bytes", ErrRecordTooLarge, offset, maxFileLineBytes(maxRecordBytes))
+		}
+		return fmt.Errorf("error reading file: %s", scanner.Err())
+	}
+
+	for {
+		line, ok := next()
+		if !ok {
+			break
+		}
+		if offset > size {
+			return end, ErrTornRecord
+		}
+
+		if end == 0 && line+"\n" == fileFormatHeader {
+			parse = parseFileEvent
+			end = offset
+			continue
+		}
+
+		e, err := parse(line)
+		if err != nil {
+			return end, err
+		}
+
+		if e.EventType == EventBatch {
+			count := len(e.Batch)
+			e.Batch = e.Batch[:0]
+			for len(e.Batch) < count {
+				line, ok := next()
+				if !ok {
+					break
+				}
+				if offset > size {
+					return end, ErrTornRecord
+				}
+				sub, err := parse(line)
+				if err != nil {
+					return end, err
+				}
+				if sub.Id != e.Id {
+					return end, fmt.Errorf("batch %d: entry has event id %d", e.Id, sub.Id)
+				}
+				e.Batch = append(e.Batch, sub)
+			}
+
+			// the tail of a torn batch never made it to the file,
+			// the whole batch is dropped instead of replaying half of it
+			if len(e.Batch) < count {
+				if scanner.Err() != nil {
+					return end, scanErr()
+				}
+				return end, ErrTornRecord
+			}
+		}
+
+		if err := fn(e); err != nil {
+			return end, err
+		}
+		end = offset
+	}
+
+	if scanner.Err() != nil {
+		return end, scanErr()
+	}
+	return end, nil
+}
+
+// formatFileEvent returns the lines of the event, a batch is a header
+// line with the number of entries followed by one line per entry,
+// keys and values are quoted so any bytes survive the round trip
+func formatFileEvent(id uint64, e Event) string {
+	if e.EventType == EventBatch {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%d\t%d\t%d\n", id, EventBatch, len(e.Batch))
+		for _, sub := range e.Batch {
+			sb.WriteString(formatFileEvent(id, sub))
+		}
+		return sb.String()
+	}
+
+	return fmt.Sprintf("%d\t%d\t%s\t%s\t%d\t%d\n",
+		id, e.EventType, strconv.Quote(e.Key), strconv.Quote(e.Value), e.ExpiresAt, e.Version)
+}
+
+// parseFileEvent parses a single line, the entries of
+// a batch header are left for the caller to read
+func parseFileEvent(line string) (Event, error) {
+	var e Event
+
+	fields := strings.Split(line, "\t")
+	if len(fields) < 3 {
+		return e, fmt.Errorf("invalid event line: %q", line)
+	}
+
+	var err error
+	if e.Id, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return e, fmt.Errorf("invalid event id: %s", err)
+	}
+	if e.EventType, err = strconv.Atoi(fields[1]); err != nil {
+		return e, fmt.Errorf("invalid event type: %s", err)
+	}
+
+	if e.EventType == EventBatch {
+		count, err := strconv.Atoi(fields[2])
+		if err != nil || count < 0 {
+			return e, fmt.Errorf("event %d: invalid batch size %q", e.Id, fields[2])
+		}
+		e.Batch = make([]Event, count)
+		return e, nil
+	}
+
+	if len(fields) != 6 {
+		return e, fmt.Errorf("event %d: invalid event line: %q", e.Id, line)
+	}
+	if e.Key, err = strconv.Unquote(fields[2]); err != nil {
+		return e, fmt.Errorf("event %d: invalid key %s: %s", e.Id, fields[2], err)
+	}
+	if e.Value, err = strconv.Unquote(fields[3]); err != nil {
+		return e, fmt.Errorf("event %d: invalid value: %s", e.Id, err)
+	}
+	if e.ExpiresAt, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+		return e, fmt.Errorf("event %d: invalid expiry: %s", e.Id, err)
+	}
+	if e.Version, err = strconv.ParseUint(fields[5], 10, 64); err != nil {
+		return e, fmt.Errorf("event %d: invalid version: %s", e.Id, err)
+	}
+
+	return e, nil
+}
+
+// parseLegacyFileEvent parses a line written before keys and values were quoted
+func parseLegacyFileEvent(line string) (Event, error) {
+	var e Event
+
+	contents := strings.Split(line, "\t")
+	if len(contents) < 3 {
+		return e, fmt.Errorf("invalid event line: %q", line)
+	}
+
+	num, err := strconv.Atoi(contents[1])
+	if err != nil {
+		return e, fmt.Errorf("invalid event type: %s", err)
+	}
+
+	switch num {
+	case EventPut:
+		// lines written before ttl and version support lack the trailing columns
+		n, err := fmt.Sscanf(line, "%d\t%d\t%s\t%s\t%d\t%d", &e.Id, &e.EventType, &e.Key, &e.Value, &e.ExpiresAt, &e.Version)
+		if err != nil && !(n >= 4 && errors.Is(err, io.EOF)) {
+			return e, err
+		}
+	case EventCompacted:
+		if _, err := fmt.Sscanf(line, "%d\t%d", &e.Id, &e.EventType); err != nil {
+			return e, err
+		}
+	case EventBatch:
+		var count int
+		if _, err := fmt.Sscanf(line, "%d\t%d\t%d", &e.Id, &e.EventType, &count); err != nil {
+			return e, err
+		}
+		e.Batch = make([]Event, count)
+	default:
+		if _, err := fmt.Sscanf(line, "%d\t%d\t%s\t", &e.Id, &e.EventType, &e.Key); err != nil {
+			return e, err
+		}
+	}
+
+	return e, nil
+}
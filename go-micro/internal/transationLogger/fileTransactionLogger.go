@@ -1,39 +1,84 @@
 package transactionLogger
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"strconv"
-	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type FileTransactionLogger struct {
-	events      chan<- Event
-	errors      <-chan error
+	broadcaster
+	writeQueue
 	lastEventId uint64
+	mu          sync.Mutex // guards writes to file and swapping it
 	file        *os.File
+	filename    string
+	params      FileLoggerParams
+}
+
+type FileLoggerParams struct {
+	MaxRecordBytes int // events encoding to more are rejected, 0 uses DefaultMaxRecordBytes
+	Sync           SyncPolicy
+}
+
+var DefaultFileLoggerParams = FileLoggerParams{
+	MaxRecordBytes: DefaultMaxRecordBytes,
+	Sync:           DefaultSyncPolicy,
 }
 
 func NewFileTransactionLogger(filename string) (TransactionLogger, error) {
+	return NewFileTransactionLoggerWithParams(filename, DefaultFileLoggerParams)
+}
+
+func NewFileTransactionLoggerWithParams(filename string, params FileLoggerParams) (TransactionLogger, error) {
+	if err := params.Sync.Validate(); err != nil {
+		return nil, err
+	}
+	if params.MaxRecordBytes == 0 {
+		params.MaxRecordBytes = DefaultMaxRecordBytes
+	}
+
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755)
 	if err != nil {
 		return nil, fmt.Errorf("error creating file %s: %s", filename, err)
 	}
-	return &FileTransactionLogger{file: file}, nil
+
+	f := &FileTransactionLogger{file: file, filename: filename, params: params}
+	if err := f.upgradeFormat(); err != nil {
+		f.file.Close()
+		return nil, err
+	}
+	if err := f.truncateTornTail(); err != nil {
+		f.file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileTransactionLogger) WritePut(key, value string, version uint64) {
+	f.enqueue(Event{EventType: EventPut, Key: key, Value: value, Version: version})
+}
+
+func (f *FileTransactionLogger) WritePutWithExpiry(key, value string, version uint64, expiresAt time.Time) {
+	f.enqueue(Event{EventType: EventPut, Key: key, Value: value, Version: version, ExpiresAt: expiresAt.UnixNano()})
 }
 
-func (f *FileTransactionLogger) WritePut(key, value string) {
-	f.events <- Event{EventType: EventPut, Key: key, Value: value}
+func (f *FileTransactionLogger) WriteDel(key string, version uint64) {
+	f.enqueue(Event{EventType: EventDelete, Key: key, Version: version})
 }
 
-func (f *FileTransactionLogger) WriteDel(key string) {
-	f.events <- Event{EventType: EventDelete, Key: key}
+func (f *FileTransactionLogger) WriteExpire(key string, version uint64) {
+	f.enqueue(Event{EventType: EventExpire, Key: key, Version: version})
 }
 
-func (f *FileTransactionLogger) Err() <-chan error {
-	return f.errors
+func (f *FileTransactionLogger) WriteBatch(events []Event) {
+	f.enqueue(Event{EventType: EventBatch, Batch: events})
 }
 
 func (f *FileTransactionLogger) GetLastEventId() uint64 {
@@ -43,80 +88,143 @@ func (f *FileTransactionLogger) GetLastEventId() uint64 {
 // Run function spings up go routine
 // to read the data from the events channel and write to file
 func (f *FileTransactionLogger) Run() {
-	events := make(chan Event, 16)
-	f.events = events
+	f.start("file", f.params.Sync, f.writeEvent, f.sync, f.publish)
+}
 
-	errors := make(chan error, 1)
-	f.errors = errors
+func (f *FileTransactionLogger) Close(ctx context.Context) error {
+	// the file is released once the writer returned, even if it failed
+	err := f.close(ctx)
+	if !f.writerDone() {
+		return err
+	}
 
-	go func() {
-		for event := range events {
-			atomic.AddUint64(&f.lastEventId, 1)
-			_, err := fmt.Fprintf(f.file, "%d\t%d\t%s\t%s\n", f.lastEventId, event.EventType, event.Key, event.Value)
-			if err != nil {
-				errors <- err
-				return
-			}
-		}
-	}()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return err
+	}
+	if closeErr := f.file.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("error closing file %s: %s", f.filename, closeErr)
+	}
+	f.file = nil
+	return err
 }
 
+func (f *FileTransactionLogger) sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Sync()
+}
+
+// writeEvent assigns the next event id and appends the event to the file,
+// the size of an event is measured as the proto logger encodes it
+func (f *FileTransactionLogger) writeEvent(event Event) (Event, error) {
+	if size := RecordSize(event); size > f.params.MaxRecordBytes {
+		return event, fmt.Errorf("%w: event of %d bytes, the maximum is %d", ErrRecordTooLarge, size, f.params.MaxRecordBytes)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// the id is only counted once the event is written
+	event.Id = atomic.LoadUint64(&f.lastEventId) + 1
+	if err := writeFileRecord(f.file, event); err != nil {
+		return event, err
+	}
+	atomic.StoreUint64(&f.lastEventId, event.Id)
+	return event, nil
+}
+
+// Compact rewrites the log without the events up to upTo
+func (f *FileTransactionLogger) Compact(upTo uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return ErrLoggerClosed
+	}
+
+	file, err := compactFile(f.file, upTo, f.ReadEvents, writeFileRecord)
+	if err != nil {
+		return err
+	}
+
+	f.file = file
+	return nil
+}
+
+// truncateTornTail cuts off the event a crash left partially written, so
+// that new events are appended after the last complete one, it runs once
+// before the logger does as readers of a running log stop at a torn tail
+func (f *FileTransactionLogger) truncateTornTail() error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %s", f.filename, err)
+	}
+
+	// any other error is left for the replay to report
+	end, err := readFileEvents(f.file, info.Size(), f.params.MaxRecordBytes, func(Event) error { return nil })
+	if !errors.Is(err, ErrTornRecord) {
+		return nil
+	}
+
+	slog.Warn("truncating torn record", "path", f.filename, "offset", end)
+	if err := f.file.Truncate(end); err != nil {
+		return fmt.Errorf("error truncating torn record %s: %s", f.filename, err)
+	}
+	return nil
+}
+
+// writeFileRecord writes the lines of the event, a batch is written
+// with a single write so it is either fully in the file or detected as torn on read
+func writeFileRecord(w io.Writer, event Event) error {
+	_, err := io.WriteString(w, formatFileEvent(event.Id, event))
+	return err
+}
+
+// ReadEvents streams the events of the file, it stops at a torn tail
+// which the writer may be appending while the log is read
 func (f *FileTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
 	outEvent := make(chan Event)
 	outError := make(chan error, 1)
 
 	go func() {
-		e := Event{}
+		defer close(outEvent)
+		defer close(outError)
 
-		file, err := os.OpenFile(f.file.Name(), os.O_RDWR, 0755)
+		file, err := os.Open(f.filename)
 		if err != nil {
-			outError <- fmt.Errorf("error creating file %s: %s", f.file.Name(), err)
+			outError <- fmt.Errorf("error opening file %s: %s", f.filename, err)
 			return
 		}
+		defer file.Close()
 
-		scanner := bufio.NewScanner(file)
-
-		defer close(outEvent)
-		defer close(outError)
+		info, err := file.Stat()
+		if err != nil {
+			outError <- fmt.Errorf("error reading file %s: %s", f.filename, err)
+			return
+		}
 
-		atomic.StoreUint64(&f.lastEventId, 0)
-
-		for scanner.Scan() {
-			line := scanner.Text()
-
-			contents := strings.Split(line, "\t")
-			if num, err := strconv.Atoi(contents[1]); num == EventPut {
-				if err != nil {
-					outError <- fmt.Errorf("invalid event type: %s", err)
-					return
-				}
-
-				if _, err := fmt.Sscanf(line, "%d\t%d\t%s\t%s", &e.Id, &e.EventType, &e.Key, &e.Value); err != nil {
-					outError <- err
-					return
-				}
-			} else {
-				if _, err := fmt.Sscanf(line, "%d\t%d\t%s\t", &e.Id, &e.EventType, &e.Key); err != nil {
-					outError <- err
-					return
-				}
-			}
+		// the log may be read while the logger is running,
+		// so the event id is only ever raised to the last one in the file
+		var lastId uint64
 
-			if atomic.LoadUint64(&f.lastEventId) >= e.Id {
-				outError <- fmt.Errorf("invalid sequence number")
-				return
+		_, err = readFileEvents(file, info.Size(), f.params.MaxRecordBytes, func(e Event) error {
+			if lastId >= e.Id {
+				return fmt.Errorf("invalid sequence number")
 			}
 
-			atomic.StoreUint64(&f.lastEventId, e.Id)
+			lastId = e.Id
+			storeMaxUint64(&f.lastEventId, e.Id)
 
 			outEvent <- e
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrTornRecord) {
+			outError <- err
 		}
-
-		if err := scanner.Err(); err != nil {
-			outError <- fmt.Errorf("error reading file: %s", err)
-			return
-		}
-
 	}()
 
 	return outEvent, outError
@@ -0,0 +1,123 @@
+package transactionLogger
+
+import (
+	"errors"
+	"fmt"
+	protobufLogger "go-micro/proto/transactionLogger"
+	"os"
+)
+
+// TornTail is a record a crash left partially written at the end of a log
+// file, the logger cuts it off when it opens the log
+type TornTail struct {
+	Path   string
+	Offset int64
+}
+
+// Inspection is what reading a log without changing it found besides its events
+type Inspection struct {
+	Corrupt []*CorruptRecordError // records failing their checksum, left out of the events
+	Torn    []TornTail
+}
+
+// Problems tells how many problems the log has
+func (i Inspection) Problems() int {
+	return len(i.Corrupt) + len(i.Torn)
+}
+
+// InspectFileLog calls fn for every complete event of the file log at path,
+// unlike the logger it neither upgrades a legacy log nor cuts off a torn tail
+func InspectFileLog(path string, maxRecordBytes int, fn func(Event) error) (Inspection, error) {
+	var inspection Inspection
+
+	file, err := os.Open(path)
+	if err != nil {
+		return inspection, fmt.Errorf("error opening file %s: %s", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return inspection, fmt.Errorf("error reading file %s: %s", path, err)
+	}
+
+	end, err := readFileEvents(file, info.Size(), maxRecordBytes, fn)
+	if errors.Is(err, ErrTornRecord) {
+		inspection.Torn = append(inspection.Torn, TornTail{Path: path, Offset: end})
+		err = nil
+	}
+	return inspection, err
+}
+
+// InspectProtoLog calls fn for every intact event of the segments of the proto
+// log named after path, a log which predates segments is read from path itself,
+// unlike the logger it neither adopts that file, rewrites the index nor cuts off
+// torn tails, and a compacted log starts with an EventCompacted marker
+func InspectProtoLog(path string, maxRecordBytes int, fn func(Event) error) (Inspection, error) {
+	var inspection Inspection
+	p := &ProtoTransactionLogger{filename: path}
+
+	index, found, err := p.readIndex()
+	if err != nil {
+		return inspection, err
+	}
+	seqs, err := p.listSegments()
+	if err != nil {
+		return inspection, err
+	}
+
+	var paths []string
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		paths = append(paths, path)
+	}
+	for _, seq := range seqs {
+		paths = append(paths, p.segmentPath(seq))
+	}
+
+	// without an index a log starting after the first event must have been compacted
+	compacted := index.CompactedEventId
+	var lastId uint64
+	send := func(e Event) error {
+		if lastId == 0 && !found && e.Id > 1 {
+			compacted = e.Id - 1
+		}
+		if lastId == 0 && compacted > 0 {
+			if err := fn(Event{Id: compacted, EventType: EventCompacted}); err != nil {
+				return err
+			}
+		}
+		lastId = e.Id
+		return fn(e)
+	}
+
+	for _, segmentPath := range paths {
+		end, _, err := readSegment(segmentPath, maxRecordBytes, func(event *protobufLogger.Event) error {
+			// left behind by a compaction which did not finish
+			if found && event.Id <= compacted {
+				return nil
+			}
+			return send(fromProtoEvent(event))
+		}, func(corrupt *CorruptRecordError) {
+			inspection.Corrupt = append(inspection.Corrupt, corrupt)
+		})
+
+		// the rest of a segment with a corrupt length is unreadable, the next one is not
+		var corrupt *CorruptRecordError
+		switch {
+		case errors.Is(err, ErrTornRecord):
+			inspection.Torn = append(inspection.Torn, TornTail{Path: segmentPath, Offset: end})
+		case errors.As(err, &corrupt):
+			inspection.Corrupt = append(inspection.Corrupt, corrupt)
+		case err != nil:
+			return inspection, err
+		}
+	}
+
+	// a log compacted up to its last event holds only the marker
+	if lastId == 0 && compacted > 0 {
+		if err := fn(Event{Id: compacted, EventType: EventCompacted}); err != nil {
+			return inspection, err
+		}
+	}
+	return inspection, nil
+}
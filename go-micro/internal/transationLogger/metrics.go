@@ -0,0 +1,89 @@
+package transactionLogger
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencyBuckets span 10µs to about 2.6s
+var latencyBuckets = prometheus.ExponentialBuckets(0.00001, 4, 10)
+
+var (
+	writeSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kv",
+		Subsystem: "logger",
+		Name:      "write_seconds",
+		Help:      "Time to write a single event to the log.",
+		Buckets:   latencyBuckets,
+	}, []string{"backend"})
+
+	flushSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kv",
+		Subsystem: "logger",
+		Name:      "flush_seconds",
+		Help:      "Time from writing the first event of a group until the group is synced or published.",
+		Buckets:   latencyBuckets,
+	}, []string{"backend"})
+
+	syncSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kv",
+		Subsystem: "logger",
+		Name:      "fsync_seconds",
+		Help:      "Time to fsync the log, or to commit the transaction of a group for the db backends.",
+		Buckets:   latencyBuckets,
+	}, []string{"backend"})
+
+	replaySeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kv",
+		Subsystem: "logger",
+		Name:      "replay_seconds",
+		Help:      "Time the last replay of the snapshot and the log into the store took.",
+	})
+
+	replayedEvents = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kv",
+		Subsystem: "logger",
+		Name:      "replayed_events",
+		Help:      "Events applied to the store by the last replay.",
+	})
+)
+
+// Collectors returns the metrics of the writers and the replay,
+// to be registered with the registry /metrics serves
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{writeSeconds, flushSeconds, syncSeconds, replaySeconds, replayedEvents}
+}
+
+// writerMetrics are the histograms of a single backend
+type writerMetrics struct {
+	write prometheus.Observer
+	flush prometheus.Observer
+	sync  prometheus.Observer
+}
+
+func newWriterMetrics(backend string) *writerMetrics {
+	return &writerMetrics{
+		write: writeSeconds.WithLabelValues(backend),
+		flush: flushSeconds.WithLabelValues(backend),
+		sync:  syncSeconds.WithLabelValues(backend),
+	}
+}
+
+func observeSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+func (m *writerMetrics) timeWrite(write func(Event) (Event, error)) func(Event) (Event, error) {
+	return func(e Event) (Event, error) {
+		defer observeSince(m.write, time.Now())
+		return write(e)
+	}
+}
+
+func (m *writerMetrics) timeSync(sync func() error) func() error {
+	return func() error {
+		defer observeSince(m.sync, time.Now())
+		return sync()
+	}
+}
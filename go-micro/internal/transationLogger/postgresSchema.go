@@ -0,0 +1,115 @@
+package transactionLogger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// postgresMigrations upgrade the schema of a db step by step, migration i
+// runs once in a transaction of its own and is recorded in schema_migrations
+var postgresMigrations = []string{
+	1: `CREATE TABLE IF NOT EXISTS transactions (
+		sequence BIGSERIAL PRIMARY KEY,
+		event_type INT NOT NULL,
+		"key" TEXT NOT NULL,
+		value TEXT
+	)`,
+	2: `ALTER TABLE transactions
+		ADD COLUMN IF NOT EXISTS expires_at BIGINT NOT NULL DEFAULT 0,
+		ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0`,
+	3: `ALTER TABLE transactions ADD COLUMN IF NOT EXISTS batch BIGINT NOT NULL DEFAULT 0`,
+	4: `CREATE TABLE IF NOT EXISTS compactions (up_to BIGINT NOT NULL)`,
+}
+
+// postgresSchema is the schema the migrations lead to,
+// a new db is created with it right away
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS transactions (
+		sequence BIGSERIAL PRIMARY KEY,
+		event_type INT NOT NULL,
+		"key" TEXT NOT NULL,
+		value TEXT,
+		expires_at BIGINT NOT NULL DEFAULT 0,
+		version BIGINT NOT NULL DEFAULT 0,
+		batch BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS compactions (up_to BIGINT NOT NULL)`,
+}
+
+// migratePostgres brings the schema of the db up to date, a transactions
+// table created before migrations were recorded is migrated from the start
+func migratePostgres(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INT PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations: %s", err)
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error reading schema version: %s", err)
+	}
+	if current >= len(postgresMigrations)-1 {
+		return nil
+	}
+
+	if current == 0 {
+		exists, err := postgresTableExists(db, "transactions")
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return applyMigration(db, len(postgresMigrations)-1, postgresSchema...)
+		}
+	}
+
+	for version := current + 1; version < len(postgresMigrations); version++ {
+		if err := applyMigration(db, version, postgresMigrations[version]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs the statements and records every version up to version
+func applyMigration(db *sql.DB, version int, statements ...string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting migration %d: %s", version, err)
+	}
+	defer tx.Rollback()
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("error applying migration %d: %s", version, err)
+		}
+	}
+
+	var applied int
+	err = tx.QueryRow(`SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).Scan(&applied)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error reading schema version: %s", err)
+	}
+	for v := applied + 1; v <= version; v++ {
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, v); err != nil {
+			return fmt.Errorf("error recording migration %d: %s", v, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing migration %d: %s", version, err)
+	}
+	return nil
+}
+
+// postgresTableExists tells if the table is found on the search path of the db
+func postgresTableExists(db *sql.DB, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("error checking table %s: %s", name, err)
+	}
+	return exists, nil
+}
@@ -3,16 +3,15 @@ package transactionLogger
 import (
 	"database/sql"
 	"fmt"
-	"sync/atomic"
+	"strings"
 
 	_ "github.com/lib/pq"
 )
 
+// PostgresTransactionLogger logs the events to the transactions table of a
+// Postgres db, see sqlTransactionLogger
 type PostgresTransactionLogger struct {
-	events      chan<- Event
-	errors      <-chan error
-	db          *sql.DB
-	lastEventId uint64
+	sqlTransactionLogger
 }
 
 type PostgresDBParams struct {
@@ -20,11 +19,28 @@ type PostgresDBParams struct {
 	User     string
 	Host     string
 	Password string
+	SSLMode  string // passed on to lib/pq if set, it defaults to require
 }
 
+// connValueEscaper escapes a quoted value of a lib/pq connection string
+var connValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// NewPostgresTransactionLogger connects to the db, the params left empty
+// are taken from the PG* environment variables by lib/pq
 func NewPostgresTransactionLogger(config PostgresDBParams) (TransactionLogger, error) {
-	connStr := fmt.Sprintf("host=%s dbname=%s user=%s password=%s",
-		config.Host, config.DBName, config.User, config.Password)
+	var params []string
+	for _, param := range []struct{ name, value string }{
+		{"host", config.Host},
+		{"dbname", config.DBName},
+		{"user", config.User},
+		{"password", config.Password},
+		{"sslmode", config.SSLMode},
+	} {
+		if param.value != "" {
+			params = append(params, fmt.Sprintf("%s='%s'", param.name, connValueEscaper.Replace(param.value)))
+		}
+	}
+	connStr := strings.Join(params, " ")
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
@@ -33,154 +49,28 @@ func NewPostgresTransactionLogger(config PostgresDBParams) (TransactionLogger, e
 
 	err = db.Ping()
 	if err != nil {
-		return nil, fmt.Errorf("error pining db: %s", err)
+		db.Close()
+		return nil, fmt.Errorf("error pinging db: %s", err)
 	}
-	logger := &PostgresTransactionLogger{db: db}
-	exists, err := logger.verifyTableExists("transactions")
+
+	logger, err := NewPostgresTransactionLoggerFromDB(db)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-
-	if !exists {
-		err = logger.createTable()
-		if err != nil {
-			return nil, err
-		}
-	}
-
 	return logger, nil
 }
 
-// type TransactionLogger interface {
-// 	WritePut(string, string)
-// 	WriteDel(string)
-
-// 	Err() <-chan error
-// 	Run()
-// 	ReadEvents() (<-chan Event, <-chan error) // stream the logged event in file
-// 	GetLastEventId() uint64                   // retuns the number of events written to the file
-// }
-
-func (p *PostgresTransactionLogger) WritePut(key, value string) {
-	p.events <- Event{Key: key, Value: value}
-}
-
-func (p *PostgresTransactionLogger) WriteDel(key string) {
-	p.events <- Event{Key: key}
-}
-
-func (p *PostgresTransactionLogger) Err() <-chan error {
-	return p.errors
-}
-
-func (p *PostgresTransactionLogger) Run() {
-	events := make(chan Event, 16)
-	p.events = events
-
-	errors := make(chan error, 1)
-	p.errors = errors
-
-	go func() {
-		query := `INSERT INTO transactions
-			(event_type, key, value)
-			VALUES ($1, $2, $3)`
-
-		for event := range events {
-			res, err := p.db.Exec(query, event.EventType, event.Key, event.Value)
-			if err != nil {
-				errors <- err
-			}
-			num, err := res.LastInsertId()
-			if err != nil {
-				errors <- err
-			}
-			atomic.StoreUint64(&p.lastEventId, uint64(num))
-		}
-	}()
-}
-
-func (p *PostgresTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
-	outEvent := make(chan Event)
-	outError := make(chan error, 1)
-
-	go func() {
-		defer close(outEvent)
-		defer close(outError)
-
-		query := `select sequence, event_type, key, value 
-					from transactions 
-					order by sequence`
-
-		rows, err := p.db.Query(query)
-		if err != nil {
-			outError <- fmt.Errorf("error querying db: %s", err)
-			return
-		}
-		defer rows.Close()
-
-		e := Event{}
-
-		for rows.Next() {
-			err := rows.Scan(&e.Id, &e.EventType, &e.Key, &e.Value)
-			if err != nil {
-				outError <- fmt.Errorf("error scaning: %s", err)
-				return
-			}
-
-			outEvent <- e
-		}
-
-		if err := rows.Err(); err != nil {
-			outError <- fmt.Errorf("error scanning rows: %s", err)
-		}
-	}()
-
-	return outEvent, outError
-}
-
-func (p *PostgresTransactionLogger) GetLastEventId() uint64 {
-	return atomic.LoadUint64(&p.lastEventId)
-}
-
-func (p *PostgresTransactionLogger) createTable() error {
-	query := `CREATE TABLE transactions (
-				sequence BIGSERIAL PRIMARY KEY,
-				event_type INT NOT NULL,
-				key TEXT NOT NULL,
-				value TEXT
-			);`
-
-	_, err := p.db.Exec(query)
-	if err != nil {
-		return fmt.Errorf("error creating table: %s", err)
-	}
-
-	return nil
-}
-func (p *PostgresTransactionLogger) verifyTableExists(name string) (bool, error) {
-	query := `SELECT tablename FROM pg_catalog.pg_tables
-		WHERE schemaname != 'pg_catalog' AND 
-    	schemaname != 'information_schema';`
-
-	rows, err := p.db.Query(query)
-	if err != nil {
-		return false, fmt.Errorf("error executing tables query: %s", err)
-	}
-
-	var tbname string
-	for rows.Next() {
-		err := rows.Scan(tbname)
-		if err != nil {
-			return false, fmt.Errorf("error scanning rows: %s", err)
-		}
-		if tbname == name {
-			return true, nil
-		}
+// NewPostgresTransactionLoggerFromDB migrates the schema of the db
+// and logs to it, the logger closes the db on Close
+func NewPostgresTransactionLoggerFromDB(db *sql.DB) (TransactionLogger, error) {
+	if err := migratePostgres(db); err != nil {
+		return nil, err
 	}
 
-	if err := rows.Err(); err != nil {
-		return false, fmt.Errorf("error scanning rows: %s", err)
+	p := &PostgresTransactionLogger{}
+	if err := p.open("postgres", db); err != nil {
+		return nil, err
 	}
-
-	return false, nil
+	return p, nil
 }
@@ -0,0 +1,237 @@
+package transactionLogger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	protobufLogger "go-micro/proto/transactionLogger"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// segmentMagic starts every segment written with checksummed records,
+// segments without it hold plain length prefixed records
+var segmentMagic = []byte("KVSEG\x00\x00\x01")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DefaultMaxRecordBytes bounds the encoded size of a single event
+const DefaultMaxRecordBytes = 4 << 20
+
+// ErrRecordTooLarge rejects an event whose record exceeds the maximum size,
+// the log stays usable
+var ErrRecordTooLarge = errors.New("record exceeds the maximum size")
+
+// RecordSize returns an upper bound of the encoded size of the event,
+// whichever id and versions it is logged with
+func RecordSize(e Event) int {
+	e.Id = math.MaxUint64
+	return proto.Size(toProtoEvent(withMaxVersions(e)))
+}
+
+func withMaxVersions(e Event) Event {
+	e.Version = math.MaxUint64
+	batch := make([]Event, len(e.Batch))
+	for i, sub := range e.Batch {
+		batch[i] = withMaxVersions(sub)
+	}
+	e.Batch = batch
+	return e
+}
+
+// ErrTornRecord reports a partially written record at the end of a segment
+// or file log, every record before it is intact. The readers of the loggers
+// leave out a torn tail at the end of the log, which a writer may still be
+// appending to, so only a torn record in a sealed segment is returned
+var ErrTornRecord = errors.New("torn record at the end of the log")
+
+// CorruptRecordError reports a record failing its checksum, EventId is the id
+// stored in the record if it can still be decoded, otherwise the one expected
+type CorruptRecordError struct {
+	Path    string
+	Offset  int64
+	EventId uint64
+}
+
+func (e *CorruptRecordError) Error() string {
+	return fmt.Sprintf("corrupt record in %s at offset %d, event %d", e.Path, e.Offset, e.EventId)
+}
+
+// writeProtoRecord writes the event prefixed by its length and checksum and
+// returns the bytes written, a batch is marshaled into a single record
+func writeProtoRecord(w io.Writer, e Event, maxRecordBytes int) (int, error) {
+	data, err := proto.Marshal(toProtoEvent(e))
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling event: %s", err)
+	}
+	if len(data) > maxRecordBytes {
+		return 0, fmt.Errorf("%w: event of %d bytes, the maximum is %d", ErrRecordTooLarge, len(data), maxRecordBytes)
+	}
+
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header, uint32(len(data)))
+	binary.LittleEndian.PutUint32(header[4:], recordChecksum(header[:4], data))
+	_, err = w.Write(header)
+	if err != nil {
+		return 0, fmt.Errorf("error writing data len: %s", err)
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return 0, fmt.Errorf("error writing data: %s", err)
+	}
+
+	return len(header) + len(data), nil
+}
+
+// tornRecord tells if the rest of a segment, following the header of a record
+// of datalen bytes which runs past its end, is what a crash leaves of the
+// record, a prefix of no more than the largest record holding no intact record
+func tornRecord(rest io.Reader, datalen uint32, size int64, maxRecordBytes int) bool {
+	if int64(datalen) > int64(maxRecordBytes) || size > int64(maxRecordBytes) {
+		return false
+	}
+
+	data, err := io.ReadAll(rest)
+	if err != nil {
+		return false
+	}
+	for i := 0; i+8 <= len(data); i++ {
+		n := binary.LittleEndian.Uint32(data[i:])
+		if int64(n) > int64(len(data)-i-8) {
+			continue
+		}
+		if recordChecksum(data[i:i+4], data[i+8:i+8+int(n)]) == binary.LittleEndian.Uint32(data[i+4:]) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordChecksum covers the length as well, so a corrupt length is detected
+func recordChecksum(datalen, data []byte) uint32 {
+	return crc32.Update(crc32.Checksum(datalen, crcTable), crcTable, data)
+}
+
+// readSegment calls fn for every intact record of the segment file and returns
+// the offset following the last one and whether the segment predates checksums,
+// a partially written final record yields ErrTornRecord, a corrupt record
+// within the segment yields a CorruptRecordError unless onCorrupt is given,
+// which is passed the record to skip it, and a corrupt length which leaves
+// the rest of the segment unreadable always yields a CorruptRecordError
+func readSegment(path string, maxRecordBytes int, fn func(*protobufLogger.Event) error, onCorrupt func(*CorruptRecordError)) (int64, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, fmt.Errorf("error opening segment %s: %s", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, false, fmt.Errorf("error checking segment %s: %s", path, err)
+	}
+	// records appended while reading are left to the next read
+	size := info.Size()
+	reader := bufio.NewReader(io.LimitReader(file, size))
+
+	var offset int64
+	legacy := true
+	if head, err := reader.Peek(len(segmentMagic)); err == nil && bytes.Equal(head, segmentMagic) {
+		reader.Discard(len(segmentMagic))
+		offset = int64(len(segmentMagic))
+		legacy = false
+	}
+
+	header := make([]byte, 8)
+	if legacy {
+		header = header[:4]
+	}
+	databuf := make([]byte, 4096)
+
+	var lastId uint64
+	var skipped bool
+	torn := func() (int64, bool, error) {
+		// a record cut short after a skipped one may be a misread length,
+		// so the rest of the segment is not dropped silently
+		if skipped {
+			return offset, legacy, &CorruptRecordError{Path: path, Offset: offset, EventId: lastId + 1}
+		}
+		return offset, legacy, ErrTornRecord
+	}
+
+	for {
+		_, err := io.ReadFull(reader, header)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, legacy, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return torn()
+			}
+			return offset, legacy, fmt.Errorf("error reading event entry length: %s", err)
+		}
+
+		datalen := binary.LittleEndian.Uint32(header)
+		end := offset + int64(len(header)) + int64(datalen)
+		if end > size {
+			// only a record which was cut short is torn,
+			// not a corrupt length running over the records after it
+			if !legacy && !tornRecord(reader, datalen, size-offset-int64(len(header)), maxRecordBytes) {
+				return offset, legacy, &CorruptRecordError{Path: path, Offset: offset, EventId: lastId + 1}
+			}
+			return torn()
+		}
+
+		if int64(datalen) > int64(maxRecordBytes) {
+			return offset, legacy, fmt.Errorf("record of %d bytes at offset %d of %s exceeds the maximum of %d",
+				datalen, offset, path, maxRecordBytes)
+		}
+		if int(datalen) > cap(databuf) {
+			databuf = make([]byte, datalen)
+		}
+
+		data := databuf[:datalen]
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return offset, legacy, fmt.Errorf("error reading event entry: %s", err)
+		}
+
+		if !legacy && recordChecksum(header[:4], data) != binary.LittleEndian.Uint32(header[4:]) {
+			if end == size {
+				return torn()
+			}
+
+			corrupt := &CorruptRecordError{Path: path, Offset: offset, EventId: lastId + 1}
+			event := &protobufLogger.Event{}
+			if proto.Unmarshal(data, event) == nil && event.Id > lastId {
+				corrupt.EventId = event.Id
+			}
+			if onCorrupt == nil {
+				return offset, legacy, corrupt
+			}
+			onCorrupt(corrupt)
+
+			skipped = true
+			offset = end
+			continue
+		}
+
+		event := &protobufLogger.Event{}
+		err = proto.Unmarshal(data, event)
+		if err != nil {
+			return offset, legacy, fmt.Errorf("error unmarshalling event entry at offset %d of %s: %s", offset, path, err)
+		}
+
+		if err := fn(event); err != nil {
+			return offset, legacy, err
+		}
+		lastId = event.Id
+		offset = end
+	}
+}
@@ -0,0 +1,354 @@
+package transactionLogger
+
+import (
+	"errors"
+	"fmt"
+	protobufLogger "go-micro/proto/transactionLogger"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// legacySegmentSeq is the segment a single file log
+// written before segmenting is adopted as
+const legacySegmentSeq = 0
+
+type segment struct {
+	seq          uint64
+	firstEventId uint64
+	lastEventId  uint64
+	events       int
+	size         int64
+	legacy       bool // written before records were checksummed
+}
+
+func (s *segment) add(id uint64, size int64) {
+	if s.events == 0 {
+		s.firstEventId = id
+	}
+	s.lastEventId = id
+	s.events++
+	s.size += size
+}
+
+// SegmentInfo describes a closed segment, closed segments are never
+// written again and can be copied or tailed while the logger runs
+type SegmentInfo struct {
+	Path         string
+	FirstEventId uint64
+	LastEventId  uint64
+	Events       int
+	Size         int64
+}
+
+// Segments returns the closed segments in order
+func (p *ProtoTransactionLogger) Segments() []SegmentInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	infos := make([]SegmentInfo, 0, len(p.closed))
+	for _, seg := range p.closed {
+		infos = append(infos, SegmentInfo{
+			Path:         p.segmentPath(seg.seq),
+			FirstEventId: seg.firstEventId,
+			LastEventId:  seg.lastEventId,
+			Events:       seg.events,
+			Size:         seg.size,
+		})
+	}
+	return infos
+}
+
+// Compact removes the closed segments holding only events up to upTo,
+// the active segment is never touched
+func (p *ProtoTransactionLogger) Compact(upTo uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for n < len(p.closed) && p.closed[n].lastEventId <= upTo {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	removed := p.closed[:n]
+	p.compacted = removed[n-1].lastEventId
+	p.closed = slices.Clone(p.closed[n:])
+
+	// leftovers of a crash after the index was written are removed on open
+	if err := p.writeIndex(); err != nil {
+		return err
+	}
+
+	for _, seg := range removed {
+		if err := os.Remove(p.segmentPath(seg.seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing segment %d: %s", seg.seq, err)
+		}
+	}
+
+	return nil
+}
+
+// full reports whether the active segment reached one of its limits
+func (p *ProtoTransactionLogger) full() bool {
+	if p.params.MaxSegmentBytes > 0 && p.active.size >= p.params.MaxSegmentBytes {
+		return true
+	}
+	return p.params.MaxSegmentEvents > 0 && p.active.events >= p.params.MaxSegmentEvents
+}
+
+// rotate closes the active segment, records it in the index
+// and starts a new one, the caller must hold mu
+func (p *ProtoTransactionLogger) rotate() error {
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing segment %d: %s", p.active.seq, err)
+	}
+	if err := p.file.Close(); err != nil {
+		return fmt.Errorf("error closing segment %d: %s", p.active.seq, err)
+	}
+
+	p.closed = append(p.closed, p.active)
+	if err := p.writeIndex(); err != nil {
+		return err
+	}
+
+	return p.openActive(segment{seq: p.active.seq + 1})
+}
+
+// openSegments restores the closed segments from the index, falling back
+// to scanning the segment files, and opens the newest segment for appending
+func (p *ProtoTransactionLogger) openSegments() error {
+	if err := p.adoptLegacyFile(); err != nil {
+		return err
+	}
+
+	index, found, err := p.readIndex()
+	if err != nil {
+		return err
+	}
+
+	seqs, err := p.listSegments()
+	if err != nil {
+		return err
+	}
+
+	indexed := make(map[uint64]segment)
+	for _, seg := range index.Segments {
+		indexed[seg.Seq] = segment{
+			seq:          seg.Seq,
+			firstEventId: seg.FirstEventId,
+			lastEventId:  seg.LastEventId,
+			events:       int(seg.Events),
+			size:         seg.Size,
+		}
+	}
+	p.compacted = index.CompactedEventId
+
+	// compactions remove segments from the index before their files,
+	// so an indexed segment without its file lost its events
+	for seq := range indexed {
+		if !slices.Contains(seqs, seq) {
+			return fmt.Errorf("segment %s in the index is missing", p.segmentPath(seq))
+		}
+	}
+
+	active := segment{seq: 1}
+	for i, seq := range seqs {
+		seg, ok := indexed[seq]
+		if !ok {
+			seg, err = p.scanSegment(seq, i == len(seqs)-1)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the newest segment is still active unless it was closed by a rotation,
+		// records are only appended with checksums so a legacy one is closed as well
+		if i == len(seqs)-1 && !ok && (!seg.legacy || seg.size == 0) {
+			active = seg
+			break
+		}
+
+		// left behind by a compaction which did not finish
+		if seg.events > 0 && seg.lastEventId <= p.compacted {
+			os.Remove(p.segmentPath(seq))
+			continue
+		}
+
+		p.closed = append(p.closed, seg)
+		active = segment{seq: seq + 1}
+	}
+
+	// without an index a log starting after the first event must have been compacted
+	if !found {
+		first := active.firstEventId
+		if len(p.closed) > 0 {
+			first = p.closed[0].firstEventId
+		}
+		if first > 1 {
+			p.compacted = first - 1
+		}
+	}
+
+	lastEventId := max(p.compacted, active.lastEventId)
+	if len(p.closed) > 0 {
+		lastEventId = max(lastEventId, p.closed[len(p.closed)-1].lastEventId)
+	}
+	atomic.StoreUint64(&p.lastEventId, lastEventId)
+
+	if err := p.writeIndex(); err != nil {
+		return err
+	}
+
+	return p.openActive(active)
+}
+
+func (p *ProtoTransactionLogger) openActive(seg segment) error {
+	path := p.segmentPath(seg.seq)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating file %s: %s", path, err)
+	}
+
+	if seg.size == 0 {
+		if _, err := file.Write(segmentMagic); err != nil {
+			file.Close()
+			return fmt.Errorf("error writing segment header %s: %s", path, err)
+		}
+		seg.size = int64(len(segmentMagic))
+		seg.legacy = false
+	}
+
+	p.file = file
+	p.active = seg
+	return nil
+}
+
+// adoptLegacyFile turns a log written before segmenting into the first segment
+func (p *ProtoTransactionLogger) adoptLegacyFile() error {
+	info, err := os.Stat(p.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking file %s: %s", p.filename, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a log file", p.filename)
+	}
+
+	if err := os.Rename(p.filename, p.segmentPath(legacySegmentSeq)); err != nil {
+		return fmt.Errorf("error adopting log file %s: %s", p.filename, err)
+	}
+	return nil
+}
+
+// scanSegment reads a segment file to find its first and last event id,
+// a record torn by a crash while it was written is cut off the last segment,
+// which is the only one a crash can leave torn
+func (p *ProtoTransactionLogger) scanSegment(seq uint64, last bool) (segment, error) {
+	path := p.segmentPath(seq)
+	seg := segment{seq: seq}
+	end, legacy, err := readSegment(path, p.params.MaxRecordBytes, func(event *protobufLogger.Event) error {
+		seg.add(event.Id, 0)
+		return nil
+	}, nil)
+	if errors.Is(err, ErrTornRecord) && last {
+		slog.Warn("truncating torn record", "path", path, "offset", end)
+		if err := os.Truncate(path, end); err != nil {
+			return seg, fmt.Errorf("error truncating segment %s: %s", path, err)
+		}
+		err = nil
+	}
+	if err != nil {
+		return seg, fmt.Errorf("error scanning segment %s: %w", path, err)
+	}
+
+	seg.size = end
+	seg.legacy = legacy
+	return seg, nil
+}
+
+// listSegments returns the sequence numbers of the segment files in order
+func (p *ProtoTransactionLogger) listSegments() ([]uint64, error) {
+	matches, err := filepath.Glob(p.filename + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("error listing segments: %s", err)
+	}
+
+	var seqs []uint64
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, p.filename+".")
+		seq, err := strconv.ParseUint(suffix, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+
+	slices.Sort(seqs)
+	return seqs, nil
+}
+
+// readIndex returns the index and whether it exists
+func (p *ProtoTransactionLogger) readIndex() (*protobufLogger.SegmentIndex, bool, error) {
+	index := &protobufLogger.SegmentIndex{}
+
+	data, err := os.ReadFile(p.indexPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return index, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading segment index: %s", err)
+	}
+
+	if err := proto.Unmarshal(data, index); err != nil {
+		return nil, false, fmt.Errorf("error unmarshalling segment index: %s", err)
+	}
+	return index, true, nil
+}
+
+// writeIndex durably replaces the index with the closed segments
+func (p *ProtoTransactionLogger) writeIndex() error {
+	index := &protobufLogger.SegmentIndex{CompactedEventId: p.compacted}
+	for _, seg := range p.closed {
+		index.Segments = append(index.Segments, &protobufLogger.Segment{
+			Seq:          seg.seq,
+			FirstEventId: seg.firstEventId,
+			LastEventId:  seg.lastEventId,
+			Events:       uint64(seg.events),
+			Size:         seg.size,
+		})
+	}
+
+	data, err := proto.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("error marshaling segment index: %s", err)
+	}
+
+	path := p.indexPath()
+	if err := writeFileSync(path+".tmp", data); err != nil {
+		return fmt.Errorf("error writing segment index: %s", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error replacing segment index: %s", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func (p *ProtoTransactionLogger) segmentPath(seq uint64) string {
+	return fmt.Sprintf("%s.%06d", p.filename, seq)
+}
+
+func (p *ProtoTransactionLogger) indexPath() string {
+	return p.filename + ".index"
+}
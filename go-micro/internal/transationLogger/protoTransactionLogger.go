@@ -2,163 +2,248 @@ package transactionLogger
 
 import (
 	"bufio"
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
 	protobufLogger "go-micro/proto/transactionLogger"
-	"io"
-	"log"
 	"os"
+	"sync"
 	"sync/atomic"
-
-	"google.golang.org/protobuf/proto"
+	"time"
 )
 
+type ProtoLoggerParams struct {
+	MaxSegmentBytes  int64 // rotate once the active segment reaches this size, 0 disables
+	MaxSegmentEvents int   // rotate once the active segment holds this many events, 0 disables
+	MaxRecordBytes   int   // events encoding to more are rejected, 0 uses DefaultMaxRecordBytes
+	Sync             SyncPolicy
+}
+
+var DefaultProtoLoggerParams = ProtoLoggerParams{
+	MaxSegmentBytes: 64 << 20,
+	MaxRecordBytes:  DefaultMaxRecordBytes,
+	Sync:            DefaultSyncPolicy,
+}
+
+// ProtoTransactionLogger writes length prefixed protobuf records
+// into segment files, only the newest segment is ever written to
 type ProtoTransactionLogger struct {
-	events      chan<- Event
-	errors      <-chan error
+	broadcaster
+	writeQueue
 	lastEventId uint64
-	file        *os.File
+	params      ProtoLoggerParams
+	filename    string // base name of the segments and the index
+
+	mu        sync.Mutex // guards the segments and writes to file
+	closed    []segment  // closed segments in order, persisted in the index
+	compacted uint64     // id of the last event dropped by Compact
+	active    segment
+	file      *os.File // active segment
+	rotateErr error    // a rotation which failed after the event before it was written
 }
 
 func NewProtoTransactionLogger(filename string) (TransactionLogger, error) {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755)
-	if err != nil {
-		return nil, fmt.Errorf("error creating file %s: %s", filename, err)
+	return NewProtoTransactionLoggerWithParams(filename, DefaultProtoLoggerParams)
+}
+
+func NewProtoTransactionLoggerWithParams(filename string, params ProtoLoggerParams) (TransactionLogger, error) {
+	if err := params.Sync.Validate(); err != nil {
+		return nil, err
+	}
+	if params.MaxRecordBytes == 0 {
+		params.MaxRecordBytes = DefaultMaxRecordBytes
 	}
 
-	return &ProtoTransactionLogger{
-		file: file,
-	}, nil
+	p := &ProtoTransactionLogger{
+		params:   params,
+		filename: filename,
+	}
+
+	if err := p.openSegments(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *ProtoTransactionLogger) WritePut(key, value string, version uint64) {
+	p.enqueue(Event{EventType: EventPut, Key: key, Value: value, Version: version})
 }
 
-func (p *ProtoTransactionLogger) WritePut(key, value string) {
-	p.events <- Event{EventType: EventPut, Key: key, Value: value}
+func (p *ProtoTransactionLogger) WritePutWithExpiry(key, value string, version uint64, expiresAt time.Time) {
+	p.enqueue(Event{EventType: EventPut, Key: key, Value: value, Version: version, ExpiresAt: expiresAt.UnixNano()})
 }
 
-func (p *ProtoTransactionLogger) WriteDel(key string) {
-	p.events <- Event{EventType: EventDelete, Key: key}
+func (p *ProtoTransactionLogger) WriteDel(key string, version uint64) {
+	p.enqueue(Event{EventType: EventDelete, Key: key, Version: version})
 }
 
-func (p *ProtoTransactionLogger) Err() <-chan error {
-	return p.errors
+func (p *ProtoTransactionLogger) WriteExpire(key string, version uint64) {
+	p.enqueue(Event{EventType: EventExpire, Key: key, Version: version})
+}
+
+func (p *ProtoTransactionLogger) WriteBatch(events []Event) {
+	p.enqueue(Event{EventType: EventBatch, Batch: events})
 }
 
 func (p *ProtoTransactionLogger) Run() {
-	eventChan := make(chan Event, 16)
-	p.events = eventChan
+	writer := bufio.NewWriter(p.file)
+	write := func(e Event) (Event, error) {
+		return p.writeEvent(writer, e)
+	}
+	p.start("proto", p.params.Sync, write, p.sync, p.publish)
+}
 
-	errorChan := make(chan error, 1)
-	p.errors = errorChan
+func (p *ProtoTransactionLogger) Close(ctx context.Context) error {
+	// the segment is released once the writer returned, even if it failed
+	err := p.close(ctx)
+	if !p.writerDone() {
+		return err
+	}
 
-	go func() {
-		writer := bufio.NewWriter(p.file)
-		datalen := make([]byte, 4)
-		event := &protobufLogger.Event{}
-		for e := range eventChan {
-			atomic.AddUint64(&p.lastEventId, 1)
-
-			event.Id = atomic.LoadUint64(&p.lastEventId)
-			event.EventType = uint32(e.EventType)
-			event.Key = e.Key
-			event.Value = e.Value
-
-			data, err := proto.Marshal(event)
-			if err != nil {
-				errorChan <- fmt.Errorf("error marshaling event: %s", err)
-				return
-			}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-			binary.LittleEndian.PutUint32(datalen, uint32(len(data)))
-			_, err = writer.Write(datalen)
-			if err != nil {
-				errorChan <- fmt.Errorf("error writing data len: %s", err)
-				return
-			}
+	if p.file == nil {
+		return err
+	}
+	if closeErr := p.file.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("error closing segment %d: %s", p.active.seq, closeErr)
+	}
+	p.file = nil
+	return err
+}
 
-			_, err = writer.Write(data)
-			if err != nil {
-				errorChan <- fmt.Errorf("error writing data: %s", err)
-				return
-			}
+// sync fsyncs the active segment, rotated segments were synced when closed
+func (p *ProtoTransactionLogger) sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
-			err = writer.Flush()
-			if err != nil {
-				errorChan <- fmt.Errorf("error flushing data: %s", err)
-				return
-			}
+	if p.rotateErr != nil {
+		return p.rotateErr
+	}
+	return p.file.Sync()
+}
+
+// writeEvent assigns the next event id, appends the event
+// to the active segment and rotates it once it is full
+func (p *ProtoTransactionLogger) writeEvent(writer *bufio.Writer, e Event) (Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rotateErr != nil {
+		return e, p.rotateErr
+	}
+
+	// rotation swaps the file
+	writer.Reset(p.file)
+
+	// the id is only counted once the event is written
+	e.Id = atomic.LoadUint64(&p.lastEventId) + 1
+	n, err := writeProtoRecord(writer, e, p.params.MaxRecordBytes)
+	if err != nil {
+		return e, err
+	}
+	if err := writer.Flush(); err != nil {
+		return e, fmt.Errorf("error flushing data: %s", err)
+	}
+	atomic.StoreUint64(&p.lastEventId, e.Id)
+
+	p.active.add(e.Id, int64(n))
+	if p.full() {
+		// the event is written, so the rotation fails the sync
+		// of its group and the writes after it instead
+		if err := p.rotate(); err != nil {
+			p.rotateErr = err
 		}
-	}()
+	}
+
+	return e, nil
 }
 
+// ReadEvents streams the events of the closed segments followed by the active one,
+// a log which was compacted starts with an EventCompacted marker
 func (p *ProtoTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
 	outEvent := make(chan Event)
 	outError := make(chan error, 1)
 
+	p.mu.Lock()
+	paths := make([]string, 0, len(p.closed)+1)
+	for _, seg := range p.closed {
+		paths = append(paths, p.segmentPath(seg.seq))
+	}
+	paths = append(paths, p.segmentPath(p.active.seq))
+	compacted := p.compacted
+	p.mu.Unlock()
+
 	go func() {
 		defer close(outEvent)
 		defer close(outError)
 
-		atomic.StoreUint64(&p.lastEventId, 0)
-
-		file, err := os.OpenFile(p.file.Name(), os.O_RDWR, 0755)
-		if err != nil {
-			outError <- fmt.Errorf("error creating file %s: %s", p.file.Name(), err)
-			return
+		// the log may be read while the logger is running,
+		// so the event id is only ever raised to the last one in the log
+		var lastId uint64
+		if compacted > 0 {
+			lastId = compacted
+			outEvent <- Event{Id: compacted, EventType: EventCompacted}
 		}
-		reader := bufio.NewReader(file)
 
-		lenbuf := make([]byte, 4)
-		databuf := make([]byte, 4096)
-		for {
-
-			_, err := io.ReadFull(reader, lenbuf)
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					return
+		for i, path := range paths {
+			_, _, err := readSegment(path, p.params.MaxRecordBytes, func(event *protobufLogger.Event) error {
+				if event.Id != lastId+1 {
+					return fmt.Errorf("event %d in %s follows event %d, the events in between are missing", event.Id, path, lastId)
 				}
-				outError <- fmt.Errorf("error reading event entry length: %s", err)
-				return
-			}
 
-			datalen := binary.LittleEndian.Uint32(lenbuf)
-			if datalen > 4096 {
-				// todo: add support for bigger event logs
-				log.Fatalln("plz implement support for larger buffers ;)")
-			}
+				lastId = event.Id
+				storeMaxUint64(&p.lastEventId, event.Id)
 
-			_, err = io.ReadFull(reader, databuf[:datalen])
-			if err != nil {
-				outError <- fmt.Errorf("error reading event entry: %s", err)
-				return
+				outEvent <- fromProtoEvent(event)
+				return nil
+			}, nil)
+			// the writer may be in the middle of appending to the active segment
+			if errors.Is(err, ErrTornRecord) && i == len(paths)-1 {
+				err = nil
 			}
-
-			event := &protobufLogger.Event{}
-			err = proto.Unmarshal(databuf[:datalen], event)
 			if err != nil {
-				outError <- fmt.Errorf("error unmarshalling event entry: %s", err)
+				outError <- err
 				return
 			}
-
-			if atomic.LoadUint64(&p.lastEventId) >= event.Id {
-				outError <- fmt.Errorf("invalid sequence number")
-				return
-			}
-
-			atomic.StoreUint64(&p.lastEventId, event.Id)
-
-			outEvent <- Event{
-				Id:        event.Id,
-				EventType: int(event.EventType),
-				Key:       event.Key,
-				Value:     event.Value,
-			}
 		}
 	}()
 
 	return outEvent, outError
 }
 
+func toProtoEvent(e Event) *protobufLogger.Event {
+	event := &protobufLogger.Event{
+		Id:        e.Id,
+		EventType: uint32(e.EventType),
+		Key:       e.Key,
+		Value:     e.Value,
+		ExpiresAt: e.ExpiresAt,
+		Version:   e.Version,
+	}
+	for _, sub := range e.Batch {
+		event.Batch = append(event.Batch, toProtoEvent(sub))
+	}
+	return event
+}
+
+func fromProtoEvent(event *protobufLogger.Event) Event {
+	e := Event{
+		Id:        event.Id,
+		EventType: int(event.EventType),
+		Key:       event.Key,
+		Value:     event.Value,
+		ExpiresAt: event.ExpiresAt,
+		Version:   event.Version,
+	}
+	for _, sub := range event.Batch {
+		e.Batch = append(e.Batch, fromProtoEvent(sub))
+	}
+	return e
+}
+
 func (p *ProtoTransactionLogger) GetLastEventId() uint64 {
 	return atomic.LoadUint64(&p.lastEventId)
 }
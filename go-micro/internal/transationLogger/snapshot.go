@@ -0,0 +1,243 @@
+package transactionLogger
+
+import (
+	"fmt"
+	"go-micro/internal/store"
+	protobufLogger "go-micro/proto/transactionLogger"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	snapshotPrefix  = "snapshot-"
+	snapshotSuffix  = ".pb"
+	snapshotsToKeep = 2 // older snapshots are removed after a save
+)
+
+// SnapshotStore keeps snapshots of the store in a directory,
+// each named after the id of the last event it reflects
+type SnapshotStore struct {
+	dir string
+}
+
+func NewSnapshotStore(dir string) (*SnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating snapshot dir %s: %s", dir, err)
+	}
+	return &SnapshotStore{dir: dir}, nil
+}
+
+// Save durably writes the snapshot and prunes old ones
+func (s *SnapshotStore) Save(lastEventId, revision uint64, kvs []store.KeyValue) error {
+	snapshot := &protobufLogger.Snapshot{LastEventId: lastEventId, Revision: revision}
+	for _, kv := range kvs {
+		event := &protobufLogger.Event{
+			EventType: uint32(EventPut),
+			Key:       kv.Key,
+			Value:     kv.Value,
+			Version:   kv.Version,
+		}
+		if !kv.ExpiresAt.IsZero() {
+			event.ExpiresAt = kv.ExpiresAt.UnixNano()
+		}
+		snapshot.Entries = append(snapshot.Entries, event)
+	}
+
+	data, err := proto.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("error marshaling snapshot: %s", err)
+	}
+
+	name := s.path(lastEventId)
+	tmpname := name + ".tmp"
+	if err := writeFileSync(tmpname, data); err != nil {
+		os.Remove(tmpname)
+		return fmt.Errorf("error writing snapshot %s: %s", tmpname, err)
+	}
+
+	if err := os.Rename(tmpname, name); err != nil {
+		return fmt.Errorf("error renaming snapshot %s: %s", tmpname, err)
+	}
+
+	// persist the rename before the log is compacted
+	if err := syncDir(s.dir); err != nil {
+		return err
+	}
+
+	return s.prune()
+}
+
+// Latest loads the newest snapshot and the revision of the store it was
+// taken of, lastEventId is 0 if there is none
+func (s *SnapshotStore) Latest() (lastEventId, revision uint64, kvs []store.KeyValue, err error) {
+	ids, err := s.list()
+	if err != nil || len(ids) == 0 {
+		return 0, 0, nil, err
+	}
+
+	lastEventId = ids[len(ids)-1]
+	data, err := os.ReadFile(s.path(lastEventId))
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("error reading snapshot: %s", err)
+	}
+
+	snapshot := &protobufLogger.Snapshot{}
+	if err := proto.Unmarshal(data, snapshot); err != nil {
+		return 0, 0, nil, fmt.Errorf("error unmarshalling snapshot %d: %s", lastEventId, err)
+	}
+
+	kvs = make([]store.KeyValue, 0, len(snapshot.Entries))
+	for _, e := range snapshot.Entries {
+		kv := store.KeyValue{Key: e.Key, Value: e.Value, Version: e.Version}
+		if e.ExpiresAt != 0 {
+			kv.ExpiresAt = time.Unix(0, e.ExpiresAt)
+		}
+		kvs = append(kvs, kv)
+	}
+
+	return snapshot.LastEventId, snapshot.Revision, kvs, nil
+}
+
+// list returns the ids of the snapshots in ascending order
+func (s *SnapshotStore) list() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots: %s", err)
+	}
+
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+
+		var id uint64
+		if _, err := fmt.Sscanf(name, snapshotPrefix+"%d"+snapshotSuffix, &id); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *SnapshotStore) prune() error {
+	ids, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	for len(ids) > snapshotsToKeep {
+		if err := os.Remove(s.path(ids[0])); err != nil {
+			return fmt.Errorf("error removing snapshot %d: %s", ids[0], err)
+		}
+		ids = ids[1:]
+	}
+
+	return nil
+}
+
+func (s *SnapshotStore) path(lastEventId uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, lastEventId, snapshotSuffix))
+}
+
+// TakeSnapshot snapshots the store and compacts the log up to the snapshot,
+// returning the id of the last event the snapshot reflects
+func TakeSnapshot(logger TransactionLogger, store store.Store, snapshots *SnapshotStore) (uint64, error) {
+	// handlers write to the store before the logger assigns an id,
+	// so every event up to this id is already in the store
+	lastEventId := logger.GetLastEventId()
+	if lastEventId == 0 {
+		return 0, nil
+	}
+
+	// the revision is read after the keys, so it covers every version
+	// they hold and the ones of the keys deleted before
+	kvs := store.Snapshot()
+	if err := snapshots.Save(lastEventId, store.Revision(), kvs); err != nil {
+		return 0, err
+	}
+
+	if err := logger.Compact(lastEventId); err != nil {
+		return 0, fmt.Errorf("error compacting log: %s", err)
+	}
+
+	return lastEventId, nil
+}
+
+// StartSnapshotter spins up a go routine which takes a snapshot every interval
+// if new events were logged, calling the returned function stops it
+// and waits for a snapshot in progress
+func StartSnapshotter(logger TransactionLogger, store store.Store, snapshots *SnapshotStore, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(finished)
+		defer ticker.Stop()
+
+		var last uint64
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if logger.GetLastEventId() == last {
+					continue
+				}
+
+				id, err := TakeSnapshot(logger, store, snapshots)
+				if err != nil {
+					slog.Error("error taking snapshot", "err", err)
+					continue
+				}
+				last = id
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-finished
+	}
+}
+
+func writeFileSync(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening dir %s: %s", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing dir %s: %s", dir, err)
+	}
+	return nil
+}
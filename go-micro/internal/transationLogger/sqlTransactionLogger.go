@@ -0,0 +1,307 @@
+package transactionLogger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// sqlTransactionLogger logs every event as a row of the transactions table,
+// the sequence of the row is the event id, the entries of a batch are rows
+// of their own pointing at the sequence of the batch row, the Postgres
+// and SQLite loggers share it and only differ in their schema
+type sqlTransactionLogger struct {
+	broadcaster
+	writeQueue
+	backend     string // labels the metrics
+	db          *sql.DB
+	lastEventId uint64
+
+	// the group being written is inserted in a single db transaction,
+	// only used by the writer
+	tx        *sql.Tx
+	pendingId uint64
+}
+
+const sqlInsertQuery = `INSERT INTO transactions
+	(event_type, "key", value, expires_at, version, batch)
+	VALUES `
+
+// open logs to the db, whose schema must be up to date
+func (s *sqlTransactionLogger) open(backend string, db *sql.DB) error {
+	s.backend = backend
+	s.db = db
+
+	last, err := s.lastSequence()
+	if err != nil {
+		return err
+	}
+	compacted, err := s.compactedUpTo()
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(&s.lastEventId, max(last, compacted))
+
+	return nil
+}
+
+func (s *sqlTransactionLogger) WritePut(key, value string, version uint64) {
+	s.enqueue(Event{EventType: EventPut, Key: key, Value: value, Version: version})
+}
+
+func (s *sqlTransactionLogger) WritePutWithExpiry(key, value string, version uint64, expiresAt time.Time) {
+	s.enqueue(Event{EventType: EventPut, Key: key, Value: value, Version: version, ExpiresAt: expiresAt.UnixNano()})
+}
+
+func (s *sqlTransactionLogger) WriteDel(key string, version uint64) {
+	s.enqueue(Event{EventType: EventDelete, Key: key, Version: version})
+}
+
+func (s *sqlTransactionLogger) WriteExpire(key string, version uint64) {
+	s.enqueue(Event{EventType: EventExpire, Key: key, Version: version})
+}
+
+func (s *sqlTransactionLogger) WriteBatch(events []Event) {
+	s.enqueue(Event{EventType: EventBatch, Batch: events})
+}
+
+// Run starts the writer, the events queued up while
+// a group is committed are inserted in the next transaction
+func (s *sqlTransactionLogger) Run() {
+	s.start(s.backend, SyncPolicy{Mode: SyncAlways}, s.insertEvent, s.commit, s.publish)
+}
+
+func (s *sqlTransactionLogger) Close(ctx context.Context) error {
+	// the db is released once the writer returned, even if it failed
+	err := s.close(ctx)
+	if !s.writerDone() {
+		return err
+	}
+	if closeErr := s.db.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// insertEvent inserts the event into the transaction of the current group,
+// the group is rolled back if it fails
+func (s *sqlTransactionLogger) insertEvent(event Event) (Event, error) {
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return event, rolledBackError{fmt.Errorf("error starting transaction: %s", err)}
+		}
+		s.tx = tx
+	}
+
+	err := s.tx.QueryRow(sqlInsertQuery+"($1, $2, $3, $4, $5, $6) RETURNING sequence",
+		event.EventType, event.Key, event.Value, event.ExpiresAt, event.Version, 0).Scan(&event.Id)
+	if err != nil {
+		s.rollback()
+		return event, rolledBackError{fmt.Errorf("error inserting event: %s", err)}
+	}
+	s.pendingId = max(s.pendingId, event.Id)
+
+	if event.EventType == EventBatch && len(event.Batch) > 0 {
+		last, err := s.insertBatch(event.Id, event.Batch)
+		if err != nil {
+			s.rollback()
+			return event, rolledBackError{err}
+		}
+		s.pendingId = max(s.pendingId, last)
+	}
+
+	return event, nil
+}
+
+// insertBatch inserts the entries of a batch with a single statement
+// and returns the highest sequence they got
+func (s *sqlTransactionLogger) insertBatch(batchId uint64, batch []Event) (uint64, error) {
+	var sb strings.Builder
+	args := make([]any, 0, 6*len(batch))
+	sb.WriteString(sqlInsertQuery)
+	for i, e := range batch {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&sb, "($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6)
+		args = append(args, e.EventType, e.Key, e.Value, e.ExpiresAt, e.Version, batchId)
+	}
+	sb.WriteString(" RETURNING sequence")
+
+	rows, err := s.tx.Query(sb.String(), args...)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting batch entries: %s", err)
+	}
+	defer rows.Close()
+
+	var last uint64
+	for rows.Next() {
+		var sequence uint64
+		if err := rows.Scan(&sequence); err != nil {
+			return 0, fmt.Errorf("error scanning batch entry: %s", err)
+		}
+		last = max(last, sequence)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error inserting batch entries: %s", err)
+	}
+
+	return last, nil
+}
+
+// commit commits the group, its events are durable once it returns
+func (s *sqlTransactionLogger) commit() error {
+	if s.tx == nil {
+		return nil
+	}
+
+	err := s.tx.Commit()
+	s.tx = nil
+	if err != nil {
+		return rolledBackError{fmt.Errorf("error committing events: %s", err)}
+	}
+
+	storeMaxUint64(&s.lastEventId, s.pendingId)
+	return nil
+}
+
+func (s *sqlTransactionLogger) rollback() {
+	if s.tx != nil {
+		s.tx.Rollback()
+		s.tx = nil
+	}
+}
+
+// ReadEvents streams the committed events in order,
+// a log which was compacted starts with an EventCompacted marker
+func (s *sqlTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+
+		compacted, err := s.compactedUpTo()
+		if err != nil {
+			outError <- err
+			return
+		}
+		if compacted > 0 {
+			outEvent <- Event{Id: compacted, EventType: EventCompacted}
+		}
+
+		query := `SELECT sequence, event_type, "key", value, expires_at, version, batch
+			FROM transactions
+			ORDER BY sequence`
+
+		rows, err := s.db.Query(query)
+		if err != nil {
+			outError <- fmt.Errorf("error querying db: %s", err)
+			return
+		}
+		defer rows.Close()
+
+		// a batch is sent once the row after its last entry is read
+		var batch *Event
+		send := func(e Event) {
+			storeMaxUint64(&s.lastEventId, e.Id)
+			outEvent <- e
+		}
+
+		for rows.Next() {
+			var e Event
+			var value sql.NullString
+			var batchId uint64
+			err := rows.Scan(&e.Id, &e.EventType, &e.Key, &value, &e.ExpiresAt, &e.Version, &batchId)
+			if err != nil {
+				outError <- fmt.Errorf("error scanning: %s", err)
+				return
+			}
+			e.Value = value.String
+
+			if batch != nil && batchId == batch.Id {
+				entry := Event{EventType: e.EventType, Key: e.Key, Value: e.Value, ExpiresAt: e.ExpiresAt, Version: e.Version}
+				batch.Batch = append(batch.Batch, entry)
+				continue
+			}
+			if batch != nil {
+				send(*batch)
+				batch = nil
+			}
+			if batchId != 0 {
+				outError <- fmt.Errorf("event %d: entry of batch %d without the batch", e.Id, batchId)
+				return
+			}
+
+			if e.EventType == EventBatch {
+				batch = &e
+				continue
+			}
+			send(e)
+		}
+
+		if err := rows.Err(); err != nil {
+			outError <- fmt.Errorf("error scanning rows: %s", err)
+			return
+		}
+		if batch != nil {
+			send(*batch)
+		}
+	}()
+
+	return outEvent, outError
+}
+
+// Compact deletes the rows up to the sequence number upTo, the entries
+// of a batch are committed with it so they are never split by upTo
+func (s *sqlTransactionLogger) Compact(upTo uint64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM transactions WHERE sequence <= $1`, upTo); err != nil {
+		return fmt.Errorf("error deleting compacted rows: %s", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO compactions (up_to) VALUES ($1)`, upTo); err != nil {
+		return fmt.Errorf("error recording compaction: %s", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing compaction: %s", err)
+	}
+	return nil
+}
+
+func (s *sqlTransactionLogger) GetLastEventId() uint64 {
+	return atomic.LoadUint64(&s.lastEventId)
+}
+
+func (s *sqlTransactionLogger) lastSequence() (uint64, error) {
+	return s.queryUint64(`SELECT sequence FROM transactions ORDER BY sequence DESC LIMIT 1`)
+}
+
+func (s *sqlTransactionLogger) compactedUpTo() (uint64, error) {
+	return s.queryUint64(`SELECT up_to FROM compactions ORDER BY up_to DESC LIMIT 1`)
+}
+
+// queryUint64 returns the single value of the query, 0 if there is no row
+func (s *sqlTransactionLogger) queryUint64(query string) (uint64, error) {
+	var n uint64
+	err := s.db.QueryRow(query).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error querying db: %s", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,87 @@
+package transactionLogger
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteTransactionLogger logs the events to the transactions table of a
+// single file SQLite db, see sqlTransactionLogger
+type SQLiteTransactionLogger struct {
+	sqlTransactionLogger
+}
+
+// sqliteSchemaVersion is stored in the user_version of the db
+// so later schema changes know what to migrate from
+const sqliteSchemaVersion = 1
+
+// the sequence is AUTOINCREMENT so compacted sequence numbers are never reused
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS transactions (
+		sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_type INTEGER NOT NULL,
+		"key" TEXT NOT NULL,
+		value TEXT,
+		expires_at INTEGER NOT NULL DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 0,
+		batch INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS compactions (up_to INTEGER NOT NULL)`,
+	fmt.Sprintf(`PRAGMA user_version = %d`, sqliteSchemaVersion),
+}
+
+// NewSQLiteTransactionLogger opens or creates the db at filename in WAL mode,
+// so the log can be read by other processes while it is written, a group
+// of events is committed in a single transaction with a full fsync
+func NewSQLiteTransactionLogger(filename string) (TransactionLogger, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=synchronous(FULL)"+
+		"&_pragma=busy_timeout(5000)&_txlock=immediate", filename)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %s", err)
+	}
+
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLiteTransactionLogger{}
+	if err := s.open("sqlite", db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("error reading schema version: %s", err)
+	}
+	if version > sqliteSchemaVersion {
+		return fmt.Errorf("schema version %d is newer than %d", version, sqliteSchemaVersion)
+	}
+	if version == sqliteSchemaVersion {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting migration: %s", err)
+	}
+	defer tx.Rollback()
+
+	for _, statement := range sqliteSchema {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("error creating schema: %s", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing schema: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package transactionLogger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-micro/internal/store"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FailurePolicy decides what a Supervisor does once the writer of its logger gave up
+type FailurePolicy int
+
+const (
+	FailStop     FailurePolicy = iota // report the failure on Err so the server stops
+	FailReadOnly                      // refuse writes until a restart, the store is still read
+	FailRetry                         // refuse writes while the log is reopened with a backoff
+)
+
+func (p FailurePolicy) String() string {
+	switch p {
+	case FailStop:
+		return "stop"
+	case FailReadOnly:
+		return "read-only"
+	case FailRetry:
+		return "retry"
+	default:
+		return fmt.Sprintf("FailurePolicy(%d)", int(p))
+	}
+}
+
+// ErrReadOnly refuses the writes of a supervised logger whose writer gave up
+var ErrReadOnly = errors.New("transaction log is read only")
+
+const (
+	minReopenInterval = time.Second
+	maxReopenInterval = time.Minute
+
+	// failedCloseTimeout bounds closing the logger which failed before it is reopened
+	failedCloseTimeout = 5 * time.Second
+)
+
+// SupervisorParams configure a Supervisor
+type SupervisorParams struct {
+	Policy   FailurePolicy
+	Reopen   func() (TransactionLogger, error) // opens the log again, required by FailRetry
+	Store    store.Store                       // the reopened log is replayed into, required by FailRetry
+	OnChange func(err error)                   // called with the failure, and with nil once writes are logged again
+}
+
+// Supervisor runs a logger and watches for the error its writer gave up on,
+// without it nobody reads Err, once the logger failed writes are refused
+// with ErrReadOnly rather than applied to a store they are not logged for
+type Supervisor struct {
+	params SupervisorParams
+
+	mu      sync.RWMutex
+	logger  TransactionLogger
+	failure error // wraps ErrReadOnly, nil while the logger runs
+	closed  bool
+
+	errors chan error    // the failure under FailStop
+	done   chan struct{} // closed by Close
+}
+
+func NewSupervisor(logger TransactionLogger, params SupervisorParams) (*Supervisor, error) {
+	if params.Policy == FailRetry && params.Reopen == nil {
+		return nil, errors.New("the retry policy requires a function reopening the log")
+	}
+	if params.Policy == FailRetry && params.Store == nil {
+		return nil, errors.New("the retry policy requires the store to replay the reopened log into")
+	}
+
+	return &Supervisor{
+		params: params,
+		logger: logger,
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+func (s *Supervisor) current() (TransactionLogger, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.logger, s.failure
+}
+
+func (s *Supervisor) setFailure(err error) {
+	s.mu.Lock()
+	s.failure = err
+	s.mu.Unlock()
+
+	if s.params.OnChange != nil {
+		s.params.OnChange(err)
+	}
+}
+
+// Run runs the logger and starts watching it
+func (s *Supervisor) Run() {
+	logger, _ := s.current()
+	logger.Run()
+	go s.watch()
+}
+
+func (s *Supervisor) watch() {
+	for {
+		logger, _ := s.current()
+
+		var err error
+		select {
+		case err = <-logger.Err():
+		case <-s.done:
+			return
+		}
+
+		slog.Error("transaction logger failed", "policy", s.params.Policy, "err", err)
+		s.setFailure(fmt.Errorf("%w: %s", ErrReadOnly, err))
+
+		switch s.params.Policy {
+		case FailStop:
+			s.errors <- err
+			return
+		case FailRetry:
+			if !s.reopen(logger) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// reopen replaces the failed logger by a new one once the log can be opened
+// and read again, it returns false if the supervisor was closed in the meantime
+//
+// the store holds the events up to the last one the failed logger wrote, the
+// writes it failed were reverted, so the events after it which reached the log
+// anyway are replayed into the store, the torn rest of one was cut off on open
+func (s *Supervisor) reopen(failed TransactionLogger) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), failedCloseTimeout)
+	failed.Close(ctx)
+	cancel()
+	written := failed.GetLastEventId()
+
+	// the watchers of the failed logger resume from the new one
+	if b, ok := failed.(interface{ dropWatchers() }); ok {
+		b.dropWatchers()
+	}
+
+	interval := minReopenInterval
+	for {
+		select {
+		case <-time.After(interval):
+		case <-s.done:
+			return false
+		}
+
+		logger, err := s.params.Reopen()
+		if err == nil {
+			err = replayAfter(logger, s.params.Store, written)
+		}
+		if err != nil {
+			slog.Warn("error reopening transaction log", "err", err, "retry_in", interval)
+			interval = min(2*interval, maxReopenInterval)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			logger.Close(context.Background())
+			return false
+		}
+		logger.Run()
+		s.logger = logger
+		s.mu.Unlock()
+
+		slog.Info("reopened transaction log", "last_event", logger.GetLastEventId())
+		s.setFailure(nil)
+		return true
+	}
+}
+
+// replayAfter reads the log through, so that the logger numbers the events it
+// writes after the ones logged already, and replays the events after the given
+// id into the store
+func replayAfter(logger TransactionLogger, store store.Store, id uint64) error {
+	events, errs := logger.ReadEvents()
+	var replayed int
+	for e := range events {
+		if e.Id > id {
+			applyEvent(store, e)
+			replayed++
+		}
+	}
+	if replayed > 0 {
+		slog.Warn("replayed events of failed writes", "events", replayed, "after", id)
+	}
+	if err := <-errs; err != nil {
+		logger.Close(context.Background())
+		return fmt.Errorf("error reading reopened log: %s", err)
+	}
+	return nil
+}
+
+// Err receives the failure of the logger under the FailStop policy
+func (s *Supervisor) Err() <-chan error {
+	return s.errors
+}
+
+// Writable returns ErrReadOnly once the logger failed
+func (s *Supervisor) Writable() error {
+	logger, failure := s.current()
+	if failure != nil {
+		return failure
+	}
+	return logger.Writable()
+}
+
+func (s *Supervisor) WritePut(key, value string, version uint64) {
+	logger, _ := s.current()
+	logger.WritePut(key, value, version)
+}
+
+func (s *Supervisor) WritePutWithExpiry(key, value string, version uint64, expiresAt time.Time) {
+	logger, _ := s.current()
+	logger.WritePutWithExpiry(key, value, version, expiresAt)
+}
+
+func (s *Supervisor) WriteDel(key string, version uint64) {
+	logger, _ := s.current()
+	logger.WriteDel(key, version)
+}
+
+func (s *Supervisor) WriteExpire(key string, version uint64) {
+	logger, _ := s.current()
+	logger.WriteExpire(key, version)
+}
+
+func (s *Supervisor) WriteBatch(events []Event) {
+	logger, _ := s.current()
+	logger.WriteBatch(events)
+}
+
+func (s *Supervisor) WritePutContext(ctx context.Context, key, value string, version uint64, expiresAt time.Time) error {
+	logger, failure := s.current()
+	if failure != nil {
+		return failure
+	}
+	return logger.WritePutContext(ctx, key, value, version, expiresAt)
+}
+
+func (s *Supervisor) WriteDelContext(ctx context.Context, key string, version uint64) error {
+	logger, failure := s.current()
+	if failure != nil {
+		return failure
+	}
+	return logger.WriteDelContext(ctx, key, version)
+}
+
+func (s *Supervisor) WriteBatchContext(ctx context.Context, events []Event) error {
+	logger, failure := s.current()
+	if failure != nil {
+		return failure
+	}
+	return logger.WriteBatchContext(ctx, events)
+}
+
+func (s *Supervisor) QueueDepth() int {
+	logger, _ := s.current()
+	return logger.QueueDepth()
+}
+
+func (s *Supervisor) ReadEvents() (<-chan Event, <-chan error) {
+	logger, _ := s.current()
+	return logger.ReadEvents()
+}
+
+func (s *Supervisor) GetLastEventId() uint64 {
+	logger, _ := s.current()
+	return logger.GetLastEventId()
+}
+
+func (s *Supervisor) Subscribe() (<-chan Event, func()) {
+	logger, _ := s.current()
+	return logger.Subscribe()
+}
+
+func (s *Supervisor) Compact(id uint64) error {
+	logger, _ := s.current()
+	return logger.Compact(id)
+}
+
+// Close stops watching the logger and closes it
+func (s *Supervisor) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	logger := s.logger
+	s.mu.Unlock()
+
+	close(s.done)
+	return logger.Close(ctx)
+}
@@ -0,0 +1,34 @@
+package transactionLogger
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is resolved through the global provider on every use,
+// so spans are only recorded once the server installed one
+var tracer = otel.Tracer("go-micro/internal/transationLogger")
+
+// startAppendSpan starts the span of a write waiting to be durable, the writer
+// adds the written and synced events to it from its own go routine
+func startAppendSpan(ctx context.Context, backend string, e Event) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("kv.logger.backend", backend)}
+	if e.EventType == EventBatch {
+		attrs = append(attrs, attribute.Int("kv.batch.size", len(e.Batch)))
+	} else {
+		attrs = append(attrs, attribute.String("kv.key", e.Key))
+	}
+	return tracer.Start(ctx, "log.append", trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -1,51 +1,140 @@
 package transactionLogger
 
-import "go-micro/internal/store"
+import (
+	"context"
+	"fmt"
+	"go-micro/internal/store"
+	"log/slog"
+	"time"
+)
 
 const (
 	EventPut int = iota
 	EventDelete
+	EventExpire // key removed by the store once its ttl elapsed
+	EventBatch  // puts and deletes applied atomically, held in Batch
+
+	// marker at the head of a compacted log, the events up to
+	// its id were dropped and live in a snapshot instead
+	EventCompacted
 )
 
 type Event struct {
 	Id        uint64 // event id: monotonically incereasing
-	EventType int    // event type: put, delete
+	EventType int    // event type: put, delete, expire
 	Key       string
 	Value     string
+	ExpiresAt int64  // unix nano deadline of a put, 0 if the key never expires
+	Version   uint64 // version of the key after a put, or the one a delete or expiry removed
+	Batch     []Event
 }
 
 type TransactionLogger interface {
-	WritePut(string, string)
-	WriteDel(string)
+	WritePut(string, string, uint64)
+	WritePutWithExpiry(string, string, uint64, time.Time) // put of a key that expires at the given time
+	WriteDel(string, uint64)                              // delete of the key at the version
+	WriteExpire(string, uint64)                           // expiry of the key at the version
+	WriteBatch([]Event)                                   // logs the events as a single record
+
+	// the context variants return once the event is durable as the sync policy
+	// of the logger defines it, or the error which kept it from being written
+	WritePutContext(ctx context.Context, key, value string, version uint64, expiresAt time.Time) error // zero expiresAt never expires
+	WriteDelContext(ctx context.Context, key string, version uint64) error
+	WriteBatchContext(ctx context.Context, events []Event) error
 
 	Err() <-chan error
+	Writable() error // why writes are refused, nil while they are logged
+	QueueDepth() int // events queued for the writer
 	Run()
 	ReadEvents() (<-chan Event, <-chan error) // stream the logged event in file
 	GetLastEventId() uint64                   // retuns the number of events written to the file
+
+	// Subscribe streams the events written from now on, with their ids set,
+	// the returned function unsubscribes
+	Subscribe() (<-chan Event, func())
+
+	// Compact drops the logged events up to the id,
+	// which must be covered by a snapshot
+	Compact(uint64) error
+
+	// Close writes and syncs the queued events and releases the log,
+	// later writes are rejected
+	Close(ctx context.Context) error
 }
 
-func InitalizeTrasactionLogger(logger TransactionLogger, store store.Store) error {
-	var err error
+// InitalizeTrasactionLogger loads the newest snapshot, if snapshots is not nil,
+// replays the events logged after it into the store and runs the logger,
+// the logger is not run if the log cannot be read in full
+func InitalizeTrasactionLogger(logger TransactionLogger, store store.Store, snapshots *SnapshotStore) error {
+	start := time.Now()
+	var replayed int
+
+	var snapshotId uint64
+	if snapshots != nil {
+		id, revision, kvs, err := snapshots.Latest()
+		if err != nil {
+			return fmt.Errorf("error loading snapshot: %s", err)
+		}
+
+		for _, kv := range kvs {
+			store.Restore(kv.Key, kv.Value, kv.Version, kv.ExpiresAt)
+		}
+		store.RestoreRevision(revision)
+		snapshotId = id
+	}
 
-	events, errors := logger.ReadEvents()
-	e := Event{}
-	ok := true
+	// the readers send at most one error and close both channels once
+	// they are done, so the error is read after the last event
+	events, errs := logger.ReadEvents()
+	var compactedId uint64
 
 	// read events into in-mem store
-	for ok && err == nil {
-		select {
-		case err, ok = <-errors:
-		case e, ok = <-events:
-			switch e.EventType {
-			case EventDelete:
-				store.Del(e.Key)
-			case EventPut:
-				store.Put(e.Key, e.Value)
-			}
+	for e := range events {
+		if e.EventType == EventCompacted {
+			compactedId = e.Id
 		}
+
+		// the snapshot already holds the older events
+		if e.Id > snapshotId {
+			applyEvent(store, e)
+			replayed++
+		}
+	}
+	if err := <-errs; err != nil {
+		return fmt.Errorf("error replaying log after %d events: %s", replayed, err)
+	}
+
+	if compactedId > snapshotId {
+		return fmt.Errorf("log is compacted up to event %d but the newest snapshot is at event %d", compactedId, snapshotId)
+	}
+	if logger.GetLastEventId() < snapshotId {
+		return fmt.Errorf("log ends at event %d before the snapshot at event %d", logger.GetLastEventId(), snapshotId)
 	}
 
+	replaySeconds.Set(time.Since(start).Seconds())
+	replayedEvents.Set(float64(replayed))
+	slog.Info("replayed log", "snapshot", snapshotId, "events", replayed, "last_event", logger.GetLastEventId(), "duration", time.Since(start))
+
 	logger.Run()
 	return nil
+}
 
+// applyEvent replays a single logged event into the store, events which
+// are older than the state of their key are skipped by the store
+func applyEvent(store store.Store, e Event) {
+	switch e.EventType {
+	case EventDelete, EventExpire:
+		store.RestoreDel(e.Key, e.Version)
+	case EventPut:
+		// keys which expired while we were down are dropped by the store
+		var expiresAt time.Time
+		if e.ExpiresAt != 0 {
+			expiresAt = time.Unix(0, e.ExpiresAt)
+		}
+		store.Restore(e.Key, e.Value, e.Version, expiresAt)
+	case EventBatch:
+		for _, sub := range e.Batch {
+			applyEvent(store, sub)
+		}
+	}
 }
@@ -1,17 +1,33 @@
 package transactionLogger
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"go-micro/internal/store"
 	"go-micro/utils"
 	"math/rand/v2"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	_ "github.com/proullon/ramsql/driver"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/protobuf/proto"
 )
 
 func BenchmarkTransactionLogger(b *testing.B) {
@@ -26,6 +42,9 @@ func BenchmarkTransactionLogger(b *testing.B) {
 		}, {
 			name:    "proto transaction logger",
 			factory: NewProtoTransactionLogger,
+		}, {
+			name:    "sqlite transaction logger",
+			factory: NewSQLiteTransactionLogger,
 		},
 	}
 
@@ -45,9 +64,9 @@ func BenchmarkTransactionLogger(b *testing.B) {
 				for _, e := range events {
 					switch e.EventType {
 					case EventDelete:
-						fl.WriteDel(e.Key)
+						fl.WriteDel(e.Key, e.Version)
 					case EventPut:
-						fl.WritePut(e.Key, e.Value)
+						fl.WritePut(e.Key, e.Value, e.Version)
 					default:
 						b.Fatalf("wrong event type: %d", e.EventType)
 					}
@@ -87,6 +106,13 @@ func TestTransactionLogger(t *testing.T) {
 			name:    "proto logger",
 			factory: NewProtoTransactionLogger,
 		},
+		{
+			name:    "postgres logger",
+			factory: newPostgresStandIn,
+		}, {
+			name:    "sqlite logger",
+			factory: NewSQLiteTransactionLogger,
+		},
 	}
 
 	for _, tc := range tests {
@@ -102,9 +128,9 @@ func TestTransactionLogger(t *testing.T) {
 		for _, e := range events {
 			switch e.EventType {
 			case EventDelete:
-				fl.WriteDel(e.Key)
+				fl.WriteDel(e.Key, e.Version)
 			case EventPut:
-				fl.WritePut(e.Key, e.Value)
+				fl.WritePut(e.Key, e.Value, e.Version)
 			default:
 				t.Fatalf("wrong event type: %d", e.EventType)
 			}
@@ -195,3 +221,1560 @@ func GeneratePopDelEvent(data map[string]string) *Event {
 
 	return nil
 }
+
+func TestTransactionLoggerReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory func(string) (TransactionLogger, error)
+	}{
+		{
+			name:    "string logger",
+			factory: NewFileTransactionLogger,
+		},
+		{
+			name:    "proto logger",
+			factory: NewProtoTransactionLogger,
+		},
+		{
+			name:    "postgres logger",
+			factory: newPostgresStandIn,
+		}, {
+			name:    "sqlite logger",
+			factory: NewSQLiteTransactionLogger,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tempFile := filepath.Join(os.TempDir(), uuid.NewString()+".txt")
+			defer os.Remove(tempFile)
+
+			fl, err := tc.factory(tempFile)
+			assert.NoError(t, err)
+
+			fl.Run()
+			fl.WritePutWithExpiry("live", "value", 3, time.Now().Add(time.Hour))
+			fl.WritePutWithExpiry("stale", "value", 1, time.Now().Add(-time.Second))
+			fl.WritePut("reaped", "value", 1)
+			fl.WriteExpire("reaped", 1)
+			fl.WriteBatch([]Event{
+				{EventType: EventPut, Key: "user/1", Value: "bob", Version: 2},
+				{EventType: EventDelete, Key: "live"},
+				{EventType: EventPut, Key: "live", Value: "batched", Version: 1},
+			})
+			// the reaper logs the expiry before the key is put again,
+			// at the same version in a log written before store revisions
+			fl.WritePutWithExpiry("recreated", "value", 1, time.Now().Add(-time.Second))
+			fl.WriteExpire("recreated", 1)
+			fl.WritePut("recreated", "again", 1)
+			for fl.GetLastEventId() < 8 {
+				time.Sleep(time.Millisecond)
+			}
+
+			// replay into a fresh store
+			kvstore := store.NewKVStore()
+			err = InitalizeTrasactionLogger(fl, kvstore, nil)
+			assert.NoError(t, err)
+
+			value, version, err := kvstore.Get("live")
+			assert.NoError(t, err)
+			assert.Equal(t, "batched", value)
+			assert.Equal(t, uint64(1), version)
+
+			value, version, err = kvstore.Get("user/1")
+			assert.NoError(t, err)
+			assert.Equal(t, "bob", value)
+			assert.Equal(t, uint64(2), version)
+
+			_, _, err = kvstore.Get("stale")
+			assert.ErrorIs(t, err, store.ErrorNoSuchKey)
+
+			_, _, err = kvstore.Get("reaped")
+			assert.ErrorIs(t, err, store.ErrorNoSuchKey)
+
+			value, version, err = kvstore.Get("recreated")
+			assert.NoError(t, err)
+			assert.Equal(t, "again", value)
+			assert.Equal(t, uint64(1), version)
+		})
+	}
+}
+
+func TestTransactionLoggerReplayError(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+	fl, err := NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	fl.Run()
+	fl.WritePut("a", "1", 1)
+	assert.NoError(t, fl.Close(context.Background()))
+
+	f, err := os.OpenFile(tempFile, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("not an event\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	restarted, err := NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(restarted, store.NewKVStore(), nil)
+	assert.ErrorContains(t, err, "error replaying log after 1 events")
+
+	// the logger is not run on a log it could not read
+	assert.NoError(t, restarted.Writable())
+	assert.Equal(t, 0, restarted.QueueDepth())
+}
+
+func TestTransactionLoggerReplayStaleEvents(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+	fl, err := NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	fl.Run()
+
+	// events of a key logged after newer ones leave it as it is
+	fl.WritePut("first", "second write", 2)
+	fl.WritePut("first", "first write", 1)
+	fl.WritePut("kept", "value", 2)
+	fl.WriteDel("kept", 1)
+	fl.WritePut("deleted", "value", 1)
+	fl.WriteDel("deleted", 1)
+	assert.NoError(t, fl.Close(context.Background()))
+
+	restarted, err := NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	kvstore := store.NewKVStore()
+	assert.NoError(t, InitalizeTrasactionLogger(restarted, kvstore, nil))
+	defer restarted.Close(context.Background())
+
+	value, version, err := kvstore.Get("first")
+	assert.NoError(t, err)
+	assert.Equal(t, "second write", value)
+	assert.Equal(t, uint64(2), version)
+
+	_, version, err = kvstore.Get("kept")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), version)
+
+	_, _, err = kvstore.Get("deleted")
+	assert.ErrorIs(t, err, store.ErrorNoSuchKey)
+}
+
+func TestFileTransactionLoggerTornTail(t *testing.T) {
+	complete := fileFormatHeader + "1\t0\t\"user\"\t\"alice\"\t0\t1\n"
+
+	tests := []struct {
+		name string
+		tail string
+	}{
+		// the second entry of the batch never made it to the file
+		{name: "torn batch", tail: "2\t3\t2\n2\t0\t\"user\"\t\"bob\"\t0\t2\n"},
+		// the version 12 lost its last digit and the newline
+		{name: "torn line", tail: "2\t0\t\"user\"\t\"bob\"\t0\t1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+			err := os.WriteFile(tempFile, []byte(complete+tc.tail), 0644)
+			assert.NoError(t, err)
+
+			// the log is only truncated when it is opened, readers stop at the tail
+			fl := &FileTransactionLogger{filename: tempFile}
+			events, errs := fl.ReadEvents()
+			var ids []uint64
+			for e := range events {
+				ids = append(ids, e.Id)
+			}
+			assert.NoError(t, <-errs)
+			assert.Equal(t, []uint64{1}, ids)
+
+			data, err := os.ReadFile(tempFile)
+			assert.NoError(t, err)
+			assert.Equal(t, complete+tc.tail, string(data))
+
+			logger, err := NewFileTransactionLogger(tempFile)
+			assert.NoError(t, err)
+
+			kvstore := store.NewKVStore()
+			err = InitalizeTrasactionLogger(logger, kvstore, nil)
+			assert.NoError(t, err)
+
+			value, version, err := kvstore.Get("user")
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", value)
+			assert.Equal(t, uint64(1), version)
+
+			// new events are appended after the last complete one
+			err = logger.WritePutContext(context.Background(), "user", "carol", 2, time.Time{})
+			assert.NoError(t, err)
+			assert.NoError(t, logger.Close(context.Background()))
+
+			data, err = os.ReadFile(tempFile)
+			assert.NoError(t, err)
+			assert.Equal(t, complete+"2\t0\t\"user\"\t\"carol\"\t0\t2\n", string(data))
+		})
+	}
+}
+
+func TestFileTransactionLoggerFormat(t *testing.T) {
+	t.Run("lossless", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "transaction.log")
+		fl, err := NewFileTransactionLogger(tempFile)
+		assert.NoError(t, err)
+		err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+		assert.NoError(t, err)
+
+		pairs := map[string]string{
+			"with space":   "a value\twith a tab",
+			"multi\nline":  "\r\n",
+			"quote\"":      `back\slash "quoted"`,
+			"binary\x00":   "\x00\xff\xfe\x80",
+			"unicode ключ": "значение ✓",
+			"empty":        "",
+		}
+		ctx := context.Background()
+		for k, v := range pairs {
+			err := fl.WritePutContext(ctx, k, v, 1, time.Time{})
+			assert.NoError(t, err)
+		}
+		err = fl.WriteBatchContext(ctx, []Event{{EventType: EventPut, Key: "batch\tkey", Value: "batch\nvalue", Version: 1}})
+		assert.NoError(t, err)
+		pairs["batch\tkey"] = "batch\nvalue"
+
+		restarted, err := NewFileTransactionLogger(tempFile)
+		assert.NoError(t, err)
+		kvstore := store.NewKVStore()
+		err = InitalizeTrasactionLogger(restarted, kvstore, nil)
+		assert.NoError(t, err)
+
+		for k, v := range pairs {
+			value, _, err := kvstore.Get(k)
+			assert.NoError(t, err, k)
+			assert.Equal(t, v, value, k)
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "transaction.log")
+
+		// a log written before the format header, including lines lacking the version columns
+		content := "1\t0\told\tvalue\n" +
+			"2\t0\tuser\talice\t0\t1\n" +
+			"3\t1\told\t\n"
+		err := os.WriteFile(tempFile, []byte(content), 0644)
+		assert.NoError(t, err)
+
+		fl, err := NewFileTransactionLogger(tempFile)
+		assert.NoError(t, err)
+		kvstore := store.NewKVStore()
+		err = InitalizeTrasactionLogger(fl, kvstore, nil)
+		assert.NoError(t, err)
+
+		_, _, err = kvstore.Get("old")
+		assert.ErrorIs(t, err, store.ErrorNoSuchKey)
+		value, _, err := kvstore.Get("user")
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", value)
+		assert.Equal(t, uint64(3), fl.GetLastEventId())
+
+		// the log was rewritten in the current format
+		data, err := os.ReadFile(tempFile)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), fileFormatHeader))
+		assert.Contains(t, string(data), "2\t0\t\"user\"\t\"alice\"\t0\t1\n")
+	})
+}
+
+func TestTransactionLoggerSubscribe(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory func(string) (TransactionLogger, error)
+	}{
+		{
+			name:    "string logger",
+			factory: NewFileTransactionLogger,
+		},
+		{
+			name:    "proto logger",
+			factory: NewProtoTransactionLogger,
+		},
+		{
+			name:    "postgres logger",
+			factory: newPostgresStandIn,
+		}, {
+			name:    "sqlite logger",
+			factory: NewSQLiteTransactionLogger,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tempFile := filepath.Join(os.TempDir(), uuid.NewString()+".txt")
+			defer os.Remove(tempFile)
+
+			fl, err := tc.factory(tempFile)
+			assert.NoError(t, err)
+			fl.Run()
+
+			events, unsubscribe := fl.Subscribe()
+			fl.WritePut("hello", "world", 1)
+			fl.WriteDel("hello", 1)
+
+			for i, want := range []Event{
+				{Id: 1, EventType: EventPut, Key: "hello", Value: "world", Version: 1},
+				{Id: 2, EventType: EventDelete, Key: "hello", Version: 1},
+			} {
+				select {
+				case got := <-events:
+					assert.Equal(t, want, got)
+				case <-time.After(time.Second):
+					t.Fatalf("event %d was not published", i)
+				}
+			}
+
+			// reading the log must not rewind the event ids of the running logger
+			eventChan, _ := fl.ReadEvents()
+			for range eventChan {
+			}
+			fl.WritePut("hello", "again", 1)
+			got := <-events
+			assert.Equal(t, uint64(3), got.Id)
+
+			unsubscribe()
+			_, ok := <-events
+			assert.False(t, ok)
+		})
+	}
+
+	t.Run("slow watcher is dropped", func(t *testing.T) {
+		var b broadcaster
+		events, unsubscribe := b.Subscribe()
+		defer unsubscribe()
+
+		for i := range watcherBuffer + 1 {
+			b.publish(Event{Id: uint64(i + 1)})
+		}
+
+		count := 0
+		for range events {
+			count++
+		}
+		assert.Equal(t, watcherBuffer, count)
+	})
+}
+
+func TestTransactionLoggerSnapshot(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory func(string) (TransactionLogger, error)
+	}{
+		{
+			name:    "string logger",
+			factory: NewFileTransactionLogger,
+		},
+		{
+			// one event per segment so every event but the newest can be compacted
+			name: "proto logger",
+			factory: func(filename string) (TransactionLogger, error) {
+				return NewProtoTransactionLoggerWithParams(filename, ProtoLoggerParams{MaxSegmentEvents: 1})
+			},
+		},
+		{
+			name:    "postgres logger",
+			factory: newPostgresStandIn,
+		}, {
+			name:    "sqlite logger",
+			factory: NewSQLiteTransactionLogger,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			tempFile := filepath.Join(tempDir, "transaction.log")
+
+			snapshots, err := NewSnapshotStore(filepath.Join(tempDir, "snapshots"))
+			assert.NoError(t, err)
+
+			fl, err := tc.factory(tempFile)
+			assert.NoError(t, err)
+
+			kvstore := store.NewKVStore()
+			err = InitalizeTrasactionLogger(fl, kvstore, snapshots)
+			assert.NoError(t, err)
+
+			// write through the store and the logger like the handlers do
+			put := func(key, value string) {
+				version, err := kvstore.Put(key, value)
+				assert.NoError(t, err)
+				fl.WritePut(key, value, version)
+			}
+			put("hello", "world")
+			put("foo", "bar")
+			_, version, _ := kvstore.Del("foo")
+			fl.WriteDel("foo", version)
+			for fl.GetLastEventId() < 3 {
+				time.Sleep(time.Millisecond)
+			}
+
+			id, err := TakeSnapshot(fl, kvstore, snapshots)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(3), id)
+
+			// the snapshot keeps the version of the deleted key
+			_, revision, kvs, err := snapshots.Latest()
+			assert.NoError(t, err)
+			assert.Len(t, kvs, 1)
+			assert.Equal(t, uint64(2), revision)
+
+			// the tail after the snapshot stays in the log
+			put("hello", "again")
+			put("tail", "value")
+			for fl.GetLastEventId() < 5 {
+				time.Sleep(time.Millisecond)
+			}
+
+			eventChan, _ := fl.ReadEvents()
+			var ids []uint64
+			for e := range eventChan {
+				ids = append(ids, e.Id)
+			}
+			assert.Equal(t, []uint64{3, 4, 5}, ids)
+
+			// restart from the snapshot and the tail
+			restarted, err := tc.factory(tempFile)
+			assert.NoError(t, err)
+
+			restored := store.NewKVStore()
+			err = InitalizeTrasactionLogger(restarted, restored, snapshots)
+			assert.NoError(t, err)
+			assert.Equal(t, kvstore.Snapshot(), restored.Snapshot())
+			assert.Equal(t, kvstore.Revision(), restored.Revision())
+			assert.Equal(t, uint64(5), restarted.GetLastEventId())
+
+			// a compacted log can not be replayed without its snapshot
+			err = InitalizeTrasactionLogger(restarted, store.NewKVStore(), nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProtoTransactionLoggerSegments(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.log")
+	params := ProtoLoggerParams{MaxSegmentEvents: 10}
+
+	fl, err := NewProtoTransactionLoggerWithParams(tempFile, params)
+	assert.NoError(t, err)
+
+	kvstore := store.NewKVStore()
+	err = InitalizeTrasactionLogger(fl, kvstore, nil)
+	assert.NoError(t, err)
+
+	events, _ := GenerateEvents(25)
+	for _, e := range events {
+		switch e.EventType {
+		case EventDelete:
+			fl.WriteDel(e.Key, e.Version)
+		case EventPut:
+			fl.WritePut(e.Key, e.Value, e.Version)
+		}
+	}
+	for fl.GetLastEventId() < 25 {
+		time.Sleep(time.Millisecond)
+	}
+
+	segments := fl.(*ProtoTransactionLogger).Segments()
+	assert.Len(t, segments, 2)
+	assert.Equal(t, uint64(1), segments[0].FirstEventId)
+	assert.Equal(t, uint64(10), segments[0].LastEventId)
+	assert.Equal(t, uint64(11), segments[1].FirstEventId)
+	assert.Equal(t, uint64(20), segments[1].LastEventId)
+
+	// compaction drops closed segments only
+	err = fl.Compact(15)
+	assert.NoError(t, err)
+	assert.Len(t, fl.(*ProtoTransactionLogger).Segments(), 1)
+	_, err = os.Stat(segments[0].Path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// reopen from the index, the log starts with the compaction marker
+	restarted, err := NewProtoTransactionLoggerWithParams(tempFile, params)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(25), restarted.GetLastEventId())
+
+	eventChan, errorChan := restarted.ReadEvents()
+	var ids []uint64
+	for e := range eventChan {
+		ids = append(ids, e.Id)
+	}
+	assert.NoError(t, <-errorChan)
+	assert.Equal(t, uint64(10), ids[0])
+	assert.Equal(t, uint64(11), ids[1])
+	assert.Equal(t, uint64(25), ids[len(ids)-1])
+
+	// inspecting the log reads the same events, with or without the index
+	inspect := func() []uint64 {
+		var inspected []uint64
+		inspection, err := InspectProtoLog(tempFile, DefaultMaxRecordBytes, func(e Event) error {
+			inspected = append(inspected, e.Id)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Zero(t, inspection.Problems())
+		return inspected
+	}
+	assert.Equal(t, ids, inspect())
+
+	// the index can be rebuilt from the segment files
+	err = os.Remove(tempFile + ".index")
+	assert.NoError(t, err)
+	assert.Equal(t, ids, inspect())
+	rebuilt, err := NewProtoTransactionLoggerWithParams(tempFile, params)
+	assert.NoError(t, err)
+	assert.Len(t, rebuilt.(*ProtoTransactionLogger).Segments(), 1)
+
+	eventChan, _ = rebuilt.ReadEvents()
+	first := <-eventChan
+	assert.Equal(t, Event{Id: 10, EventType: EventCompacted}, first)
+	for range eventChan {
+	}
+}
+
+func TestProtoTransactionLoggerLegacyFile(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.log")
+
+	// a log written before segmenting, records are only prefixed by their length
+	var buf bytes.Buffer
+	for i, key := range []string{"a", "b"} {
+		data, err := proto.Marshal(toProtoEvent(Event{Id: uint64(i + 1), EventType: EventPut, Key: key, Value: key}))
+		assert.NoError(t, err)
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+		buf.Write(data)
+	}
+	err := os.WriteFile(tempFile, buf.Bytes(), 0644)
+	assert.NoError(t, err)
+
+	fl, err := NewProtoTransactionLogger(tempFile)
+	assert.NoError(t, err)
+
+	kvstore := store.NewKVStore()
+	err = InitalizeTrasactionLogger(fl, kvstore, nil)
+	assert.NoError(t, err)
+
+	value, _, err := kvstore.Get("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", value)
+	assert.Equal(t, uint64(2), fl.GetLastEventId())
+}
+
+func TestProtoTransactionLoggerCorruption(t *testing.T) {
+	var tempFile string
+
+	writeLog := func(n int) string {
+		fl, err := NewProtoTransactionLogger(tempFile)
+		assert.NoError(t, err)
+		err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+		assert.NoError(t, err)
+
+		last := fl.GetLastEventId()
+		for i := 0; i < n; i++ {
+			fl.WritePut(fmt.Sprintf("key-%d", i), "value", uint64(i+1))
+		}
+		for fl.GetLastEventId() < last+uint64(n) {
+			time.Sleep(time.Millisecond)
+		}
+		return fl.(*ProtoTransactionLogger).segmentPath(1)
+	}
+
+	readIds := func() ([]uint64, error) {
+		fl, err := NewProtoTransactionLogger(tempFile)
+		assert.NoError(t, err)
+
+		eventChan, errorChan := fl.ReadEvents()
+		var ids []uint64
+		for e := range eventChan {
+			ids = append(ids, e.Id)
+		}
+		return ids, <-errorChan
+	}
+
+	t.Run("torn tail", func(t *testing.T) {
+		tempFile = filepath.Join(t.TempDir(), "transaction.log")
+		path := writeLog(3)
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+
+		// a crash in the middle of writing the third record
+		err = os.Truncate(path, info.Size()-3)
+		assert.NoError(t, err)
+
+		ids, err := readIds()
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2}, ids)
+
+		// the torn record is gone, new records follow the intact ones
+		writeLog(1)
+		ids, err = readIds()
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2, 3}, ids)
+	})
+
+	t.Run("corrupt record", func(t *testing.T) {
+		tempFile = filepath.Join(t.TempDir(), "transaction.log")
+		path := writeLog(3)
+
+		// flip a byte in the value of the second record
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		offset := bytes.Index(data, []byte("key-1"))
+		assert.Greater(t, offset, 0)
+		data[offset] ^= 0xff
+		err = os.WriteFile(path, data, 0644)
+		assert.NoError(t, err)
+
+		// the logger refuses the log, only the torn tail of the log is left out
+		_, err = NewProtoTransactionLogger(tempFile)
+		var corrupt *CorruptRecordError
+		assert.ErrorAs(t, err, &corrupt)
+		assert.Equal(t, path, corrupt.Path)
+		assert.Equal(t, uint64(2), corrupt.EventId)
+
+		// an inspection skips the corrupt record and reports it
+		inspect := func() ([]uint64, Inspection) {
+			var ids []uint64
+			inspection, err := InspectProtoLog(tempFile, DefaultMaxRecordBytes, func(e Event) error {
+				ids = append(ids, e.Id)
+				return nil
+			})
+			assert.NoError(t, err)
+			return ids, inspection
+		}
+		ids, inspection := inspect()
+		assert.Equal(t, []uint64{1, 3}, ids)
+		assert.Len(t, inspection.Corrupt, 1)
+		assert.Empty(t, inspection.Torn)
+
+		// a torn record after the skipped one is reported as corrupt,
+		// the records after it cannot be trusted either
+		data = append(data, 0xff, 0xff, 0xff, 0x7f)
+		err = os.WriteFile(path, data, 0644)
+		assert.NoError(t, err)
+
+		_, inspection = inspect()
+		assert.Len(t, inspection.Corrupt, 2)
+		assert.Equal(t, uint64(4), inspection.Corrupt[1].EventId)
+		assert.Empty(t, inspection.Torn)
+	})
+
+	t.Run("closed segment", func(t *testing.T) {
+		tempFile = filepath.Join(t.TempDir(), "transaction.log")
+		fl, err := NewProtoTransactionLoggerWithParams(tempFile, ProtoLoggerParams{MaxSegmentEvents: 2})
+		assert.NoError(t, err)
+		assert.NoError(t, InitalizeTrasactionLogger(fl, store.NewKVStore(), nil))
+		for i := 0; i < 3; i++ {
+			fl.WritePut(fmt.Sprintf("key-%d", i), "value", uint64(i+1))
+		}
+		assert.NoError(t, fl.Close(context.Background()))
+		path := fl.(*ProtoTransactionLogger).segmentPath(1)
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+
+		// a torn record is only left out at the end of the log
+		err = os.WriteFile(path, data[:len(data)-3], 0644)
+		assert.NoError(t, err)
+		ids, err := readIds()
+		assert.ErrorIs(t, err, ErrTornRecord)
+		assert.Equal(t, []uint64{1}, ids)
+
+		// a corrupt record fails the replay
+		offset := bytes.Index(data, []byte("key-0"))
+		data[offset] ^= 0xff
+		err = os.WriteFile(path, data, 0644)
+		assert.NoError(t, err)
+		ids, err = readIds()
+		var corrupt *CorruptRecordError
+		assert.ErrorAs(t, err, &corrupt)
+		assert.Equal(t, uint64(1), corrupt.EventId)
+		assert.Empty(t, ids)
+
+		restarted, err := NewProtoTransactionLogger(tempFile)
+		assert.NoError(t, err)
+		err = InitalizeTrasactionLogger(restarted, store.NewKVStore(), nil)
+		assert.ErrorContains(t, err, "corrupt record")
+	})
+
+	t.Run("corrupt length", func(t *testing.T) {
+		tempFile = filepath.Join(t.TempDir(), "transaction.log")
+		path := writeLog(5)
+
+		// the length of the second record runs past the end of the segment
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		offset := bytes.Index(data, []byte("key-1")) - 12
+		data[offset+1] = 0x01
+		err = os.WriteFile(path, data, 0644)
+		assert.NoError(t, err)
+
+		_, err = NewProtoTransactionLogger(tempFile)
+		var corrupt *CorruptRecordError
+		assert.ErrorAs(t, err, &corrupt)
+		assert.Equal(t, int64(offset), corrupt.Offset)
+		assert.Equal(t, uint64(2), corrupt.EventId)
+
+		// the records after it are not truncated
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(data)), info.Size())
+	})
+}
+
+func TestProtoTransactionLoggerMissingEvents(t *testing.T) {
+	t.Run("missing segment", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "transaction.log")
+		fl, err := NewProtoTransactionLoggerWithParams(tempFile, ProtoLoggerParams{MaxSegmentEvents: 2})
+		assert.NoError(t, err)
+		assert.NoError(t, InitalizeTrasactionLogger(fl, store.NewKVStore(), nil))
+		for i := 0; i < 5; i++ {
+			fl.WritePut(fmt.Sprintf("key-%d", i), "value", uint64(i+1))
+		}
+		assert.NoError(t, fl.Close(context.Background()))
+
+		err = os.Remove(fl.(*ProtoTransactionLogger).segmentPath(2))
+		assert.NoError(t, err)
+
+		_, err = NewProtoTransactionLogger(tempFile)
+		assert.ErrorContains(t, err, "missing")
+	})
+
+	t.Run("id gap", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "transaction.log")
+		var buf bytes.Buffer
+		buf.Write(segmentMagic)
+		for _, id := range []uint64{1, 3} {
+			_, err := writeProtoRecord(&buf, Event{Id: id, EventType: EventPut, Key: "key", Value: "value"}, DefaultMaxRecordBytes)
+			assert.NoError(t, err)
+		}
+		path := (&ProtoTransactionLogger{filename: tempFile}).segmentPath(1)
+		assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+
+		fl, err := NewProtoTransactionLogger(tempFile)
+		assert.NoError(t, err)
+		err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+		assert.ErrorContains(t, err, "event 3 in "+path+" follows event 1")
+	})
+}
+
+func TestSyncPolicy(t *testing.T) {
+	policies := []struct {
+		name   string
+		policy SyncPolicy
+	}{
+		{name: "none", policy: SyncPolicy{Mode: SyncNone}},
+		{name: "interval", policy: SyncPolicy{Mode: SyncInterval, Interval: time.Millisecond}},
+		{name: "always", policy: SyncPolicy{Mode: SyncAlways}},
+	}
+
+	for _, p := range policies {
+		t.Run(p.name, func(t *testing.T) {
+			factories := map[string]func(string) (TransactionLogger, error){
+				"file": func(name string) (TransactionLogger, error) {
+					return NewFileTransactionLoggerWithParams(name, FileLoggerParams{Sync: p.policy})
+				},
+				"proto": func(name string) (TransactionLogger, error) {
+					return NewProtoTransactionLoggerWithParams(name, ProtoLoggerParams{Sync: p.policy})
+				},
+			}
+
+			for name, factory := range factories {
+				tempFile := filepath.Join(t.TempDir(), "transaction.log")
+				fl, err := factory(tempFile)
+				assert.NoError(t, err, name)
+				err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+				assert.NoError(t, err, name)
+
+				live, unsubscribe := fl.Subscribe()
+				for i := 0; i < 50; i++ {
+					fl.WritePut(fmt.Sprintf("key-%d", i), "value", 1)
+				}
+				for i := 0; i < 50; i++ {
+					<-live
+				}
+				unsubscribe()
+
+				restarted, err := factory(tempFile)
+				assert.NoError(t, err, name)
+				kvstore := store.NewKVStore()
+				err = InitalizeTrasactionLogger(restarted, kvstore, nil)
+				assert.NoError(t, err, name)
+				assert.Equal(t, uint64(50), restarted.GetLastEventId(), name)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewProtoTransactionLoggerWithParams(filepath.Join(t.TempDir(), "transaction.log"),
+			ProtoLoggerParams{Sync: SyncPolicy{Mode: SyncInterval}})
+		assert.Error(t, err)
+	})
+}
+
+func TestGroupCommit(t *testing.T) {
+	events := make(chan pendingEvent, 10)
+	for i := 0; i < cap(events); i++ {
+		events <- pendingEvent{Event: Event{EventType: EventPut, Key: fmt.Sprint(i)}}
+	}
+	close(events)
+
+	var written, syncs int
+	var published []Event
+	write := func(e Event) (Event, error) {
+		written++
+		e.Id = uint64(written)
+		return e, nil
+	}
+	sync := func() error {
+		// nothing is published before it is synced
+		assert.Empty(t, published)
+		syncs++
+		return nil
+	}
+	publish := func(e Event) {
+		published = append(published, e)
+	}
+
+	err := runWriter(events, SyncPolicy{Mode: SyncAlways}, write, sync, publish, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, syncs)
+	assert.Len(t, published, 10)
+}
+
+func TestGroupCommitFailure(t *testing.T) {
+	errDisk := errors.New("input/output error")
+	tests := []struct {
+		name     string
+		writeErr error // error of the third write
+		syncErr  error
+		errs     []error // what the four writers get
+	}{
+		{
+			name:     "write fails",
+			writeErr: errDisk,
+			errs:     []error{ErrNotSynced, ErrNotSynced, errDisk, nil},
+		},
+		{
+			// the events are in the log, a crash of the machine may lose them
+			name:    "write succeeds but sync fails",
+			syncErr: errDisk,
+			errs:    []error{ErrNotSynced, ErrNotSynced, ErrNotSynced, ErrNotSynced},
+		},
+		{
+			name:     "transaction rolled back",
+			writeErr: rolledBackError{errDisk},
+			errs:     []error{errDisk, errDisk, errDisk, nil},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			events := make(chan pendingEvent, 4)
+			dones := make([]chan error, cap(events))
+			for i := range dones {
+				dones[i] = make(chan error, 1)
+				events <- pendingEvent{Event: Event{EventType: EventPut, Key: fmt.Sprint(i)}, done: dones[i]}
+			}
+
+			var written int
+			write := func(e Event) (Event, error) {
+				written++
+				if written == 3 && tc.writeErr != nil {
+					return e, tc.writeErr
+				}
+				e.Id = uint64(written)
+				return e, nil
+			}
+			sync := func() error { return tc.syncErr }
+			var published int
+			publish := func(Event) { published++ }
+
+			err := runWriter(events, SyncPolicy{Mode: SyncAlways}, write, sync, publish, nil)
+			assert.ErrorIs(t, err, errDisk)
+			assert.Zero(t, published)
+
+			for i, want := range tc.errs {
+				if want == nil {
+					assert.Empty(t, dones[i], "writer %d", i)
+					continue
+				}
+				got := <-dones[i]
+				assert.ErrorIs(t, got, want, "writer %d", i)
+				if want == errDisk {
+					assert.NotErrorIs(t, got, ErrNotSynced, "writer %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncPolicyWaitingWriters(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SyncPolicy
+		syncs  int32
+	}{
+		{name: "none", policy: SyncPolicy{Mode: SyncNone}, syncs: 0},
+		{name: "interval", policy: SyncPolicy{Mode: SyncInterval, Interval: time.Hour}, syncs: 0},
+		{name: "always", policy: SyncPolicy{Mode: SyncAlways}, syncs: 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			events := make(chan pendingEvent)
+			var syncs atomic.Int32
+			write := func(e Event) (Event, error) { return e, nil }
+			sync := func() error {
+				syncs.Add(1)
+				return nil
+			}
+			stopped := make(chan error, 1)
+			go func() {
+				stopped <- runWriter(events, tc.policy, write, sync, func(Event) {}, nil)
+			}()
+
+			// a waiting write is answered after the sync its policy asks for
+			for i := 0; i < 3; i++ {
+				done := make(chan error, 1)
+				events <- pendingEvent{Event: Event{EventType: EventPut, Key: fmt.Sprint(i)}, done: done}
+				assert.NoError(t, <-done)
+			}
+			assert.Equal(t, tc.syncs, syncs.Load())
+
+			close(events)
+			assert.NoError(t, <-stopped)
+		})
+	}
+}
+
+func TestWriteQueueReadWhileStarting(t *testing.T) {
+	q := &writeQueue{}
+
+	// the metrics are served while the log is replayed and the logger started
+	stop := make(chan struct{})
+	reading := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				q.QueueDepth()
+				q.Writable()
+			}
+			if i == 0 {
+				close(reading)
+			}
+		}
+	}()
+	<-reading
+
+	write := func(e Event) (Event, error) { return e, nil }
+	q.start("test", SyncPolicy{Mode: SyncNone}, write, func() error { return nil }, func(Event) {})
+	err := q.WritePutContext(context.Background(), "a", "1", 1, time.Time{})
+	assert.NoError(t, err)
+
+	close(stop)
+	wg.Wait()
+	assert.NoError(t, q.close(context.Background()))
+}
+
+func TestTransactionLoggerWriteContext(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.log")
+	fl, err := NewFileTransactionLoggerWithParams(tempFile, FileLoggerParams{Sync: SyncPolicy{Mode: SyncNone}})
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	err = fl.WritePutContext(ctx, "a", "1", 1, time.Time{})
+	assert.NoError(t, err)
+	err = fl.WriteBatchContext(ctx, []Event{{EventType: EventPut, Key: "b", Value: "2", Version: 1}})
+	assert.NoError(t, err)
+	err = fl.WriteDelContext(ctx, "a", 1)
+	assert.NoError(t, err)
+
+	// acknowledged writes are in the log right away
+	restarted, err := NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	kvstore := store.NewKVStore()
+	err = InitalizeTrasactionLogger(restarted, kvstore, nil)
+	assert.NoError(t, err)
+	_, _, err = kvstore.Get("a")
+	assert.ErrorIs(t, err, store.ErrorNoSuchKey)
+	value, _, err := kvstore.Get("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", value)
+
+	// a failed write is reported to the writer and every later one
+	fl.(*FileTransactionLogger).file.Close()
+	err = fl.WritePutContext(ctx, "c", "3", 1, time.Time{})
+	assert.Error(t, err)
+	assert.Error(t, <-fl.Err())
+	err = fl.WriteDelContext(ctx, "c", 1)
+	assert.ErrorContains(t, err, "transaction logger stopped")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = restarted.WritePutContext(cancelled, "d", "4", 1, time.Time{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestTransactionLoggerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+
+	tempFile := filepath.Join(t.TempDir(), "transaction.log")
+	fl, err := NewProtoTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+	assert.NoError(t, err)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "handler")
+	err = fl.WritePutContext(ctx, "a", "1", 1, time.Time{})
+	assert.NoError(t, err)
+	parent.End()
+
+	// writes nobody waits for are not traced
+	fl.WriteDel("a", 1)
+	assert.NoError(t, fl.Close(context.Background()))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	appended := spans[0]
+	assert.Equal(t, "log.append", appended.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), appended.Parent().SpanID())
+	assert.Contains(t, appended.Attributes(), attribute.String("kv.logger.backend", "proto"))
+	assert.Contains(t, appended.Attributes(), attribute.String("kv.key", "a"))
+
+	var names []string
+	for _, e := range appended.Events() {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"written", "synced"}, names)
+	assert.Contains(t, appended.Events()[0].Attributes, attribute.Int64("kv.event.id", 1))
+}
+
+func TestSupervisor(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy FailurePolicy
+	}{
+		{name: "stop", policy: FailStop},
+		{name: "read only", policy: FailReadOnly},
+		{name: "retry", policy: FailRetry},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+			fl, err := NewFileTransactionLoggerWithParams(tempFile, FileLoggerParams{Sync: SyncPolicy{Mode: SyncNone}})
+			assert.NoError(t, err)
+
+			var mu sync.Mutex
+			var changes []error
+			kvstore := store.NewKVStore()
+			s, err := NewSupervisor(fl, SupervisorParams{
+				Policy: tc.policy,
+				Reopen: func() (TransactionLogger, error) {
+					return NewFileTransactionLogger(tempFile)
+				},
+				Store: kvstore,
+				OnChange: func(err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					changes = append(changes, err)
+				},
+			})
+			assert.NoError(t, err)
+			err = InitalizeTrasactionLogger(s, kvstore, nil)
+			assert.NoError(t, err)
+
+			ctx := context.Background()
+			assert.NoError(t, s.WritePutContext(ctx, "a", "1", 1, time.Time{}))
+			assert.NoError(t, s.Writable())
+
+			// the writer gives up on the next write
+			fl.(*FileTransactionLogger).file.Close()
+			assert.Error(t, s.WritePutContext(ctx, "b", "2", 1, time.Time{}))
+			assert.Eventually(t, func() bool {
+				return errors.Is(s.Writable(), ErrReadOnly)
+			}, time.Second, time.Millisecond)
+			assert.ErrorIs(t, s.WriteDelContext(ctx, "a", 1), ErrReadOnly)
+
+			switch tc.policy {
+			case FailStop:
+				assert.Error(t, <-s.Err())
+			case FailReadOnly:
+				assert.Empty(t, s.Err())
+			case FailRetry:
+				assert.Eventually(t, func() bool {
+					return s.Writable() == nil
+				}, 5*time.Second, 10*time.Millisecond)
+				assert.NoError(t, s.WritePutContext(ctx, "c", "3", 1, time.Time{}))
+				assert.Equal(t, uint64(2), s.GetLastEventId())
+			}
+
+			// the failure is returned until the logger is reopened
+			if tc.policy == FailRetry {
+				assert.NoError(t, s.Close(ctx))
+			} else {
+				assert.Error(t, s.Close(ctx))
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			assert.ErrorIs(t, changes[0], ErrReadOnly)
+			if tc.policy == FailRetry {
+				assert.Len(t, changes, 2)
+				assert.NoError(t, changes[1])
+			} else {
+				assert.Len(t, changes, 1)
+			}
+		})
+	}
+
+	_, err := NewSupervisor(nil, SupervisorParams{Policy: FailRetry})
+	assert.Error(t, err)
+	_, err = NewSupervisor(nil, SupervisorParams{Policy: FailRetry, Reopen: func() (TransactionLogger, error) { return nil, nil }})
+	assert.Error(t, err)
+}
+
+func TestSupervisorReopenReplay(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+	fl, err := NewFileTransactionLogger(tempFile)
+	assert.NoError(t, err)
+
+	kvstore := store.NewKVStore()
+	var once sync.Once
+	s, err := NewSupervisor(fl, SupervisorParams{
+		Policy: FailRetry,
+		Reopen: func() (TransactionLogger, error) {
+			// a write which failed but reached the log anyway
+			once.Do(func() {
+				file, err := os.OpenFile(tempFile, os.O_APPEND|os.O_WRONLY, 0644)
+				assert.NoError(t, err)
+				assert.NoError(t, writeFileRecord(file, Event{Id: 2, EventType: EventPut, Key: "b", Value: "2", Version: 2}))
+				assert.NoError(t, file.Close())
+			})
+			return NewFileTransactionLogger(tempFile)
+		},
+		Store: kvstore,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, InitalizeTrasactionLogger(s, kvstore, nil))
+
+	ctx := context.Background()
+	version, err := kvstore.Put("a", "1")
+	assert.NoError(t, err)
+	assert.NoError(t, s.WritePutContext(ctx, "a", "1", version, time.Time{}))
+
+	// the write of b fails, so its handler reverts it in the store
+	fl.(*FileTransactionLogger).file.Close()
+	assert.Error(t, s.WritePutContext(ctx, "b", "2", 2, time.Time{}))
+	assert.Equal(t, uint64(1), fl.GetLastEventId())
+
+	// the reopened log holds b, so the store gets it back
+	assert.Eventually(t, func() bool {
+		return s.Writable() == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	value, version, err := kvstore.Get("b")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", value)
+	assert.Equal(t, uint64(2), version)
+	assert.Equal(t, uint64(2), s.GetLastEventId())
+	assert.NoError(t, s.Close(ctx))
+}
+
+func TestProtoTransactionLoggerLargeRecords(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.log")
+	params := ProtoLoggerParams{MaxRecordBytes: 1 << 20}
+
+	fl, err := NewProtoTransactionLoggerWithParams(tempFile, params)
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	large := utils.RandomString(512 << 10)
+	err = fl.WritePutContext(ctx, "large", large, 1, time.Time{})
+	assert.NoError(t, err)
+
+	// an oversize event is rejected without stopping the logger
+	err = fl.WritePutContext(ctx, "oversize", utils.RandomString(2<<20), 1, time.Time{})
+	assert.ErrorIs(t, err, ErrRecordTooLarge)
+	err = fl.WritePutContext(ctx, "small", "value", 1, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), fl.GetLastEventId())
+
+	restarted, err := NewProtoTransactionLoggerWithParams(tempFile, params)
+	assert.NoError(t, err)
+	kvstore := store.NewKVStore()
+	err = InitalizeTrasactionLogger(restarted, kvstore, nil)
+	assert.NoError(t, err)
+	value, _, err := kvstore.Get("large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, value)
+
+	// a record above a lowered maximum is an error, not a crash
+	_, err = NewProtoTransactionLoggerWithParams(tempFile, ProtoLoggerParams{MaxRecordBytes: 4096})
+	assert.ErrorContains(t, err, "exceeds the maximum")
+}
+
+func TestFileTransactionLoggerLargeRecords(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.txt")
+	params := FileLoggerParams{MaxRecordBytes: 1 << 20}
+
+	fl, err := NewFileTransactionLoggerWithParams(tempFile, params)
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+	assert.NoError(t, err)
+
+	// quoting takes up to four bytes for every byte of the value
+	ctx := context.Background()
+	large := strings.Repeat("\x00", 512<<10)
+	err = fl.WritePutContext(ctx, "large", large, 1, time.Time{})
+	assert.NoError(t, err)
+
+	// an oversize event is rejected without stopping the logger
+	err = fl.WritePutContext(ctx, "oversize", utils.RandomString(2<<20), 1, time.Time{})
+	assert.ErrorIs(t, err, ErrRecordTooLarge)
+	err = fl.WriteBatchContext(ctx, []Event{{EventType: EventPut, Key: "oversize", Value: utils.RandomString(2 << 20), Version: 1}})
+	assert.ErrorIs(t, err, ErrRecordTooLarge)
+	err = fl.WritePutContext(ctx, "small", "value", 1, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), fl.GetLastEventId())
+	assert.NoError(t, fl.Close(ctx))
+
+	restarted, err := NewFileTransactionLoggerWithParams(tempFile, params)
+	assert.NoError(t, err)
+	kvstore := store.NewKVStore()
+	err = InitalizeTrasactionLogger(restarted, kvstore, nil)
+	assert.NoError(t, err)
+	value, _, err := kvstore.Get("large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, value)
+	assert.NoError(t, restarted.Close(ctx))
+
+	// a line above a lowered maximum is an error, not a torn tail
+	lowered, err := NewFileTransactionLoggerWithParams(tempFile, FileLoggerParams{MaxRecordBytes: 4096})
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(lowered, store.NewKVStore(), nil)
+	assert.ErrorContains(t, err, "exceeds the maximum")
+}
+
+func TestTransactionLoggerClose(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory func(string) (TransactionLogger, error)
+	}{
+		{
+			name: "file",
+			factory: func(name string) (TransactionLogger, error) {
+				return NewFileTransactionLoggerWithParams(name, FileLoggerParams{Sync: SyncPolicy{Mode: SyncNone}})
+			},
+		},
+		{
+			name: "proto",
+			factory: func(name string) (TransactionLogger, error) {
+				return NewProtoTransactionLoggerWithParams(name, ProtoLoggerParams{Sync: SyncPolicy{Mode: SyncNone}})
+			},
+		},
+		{
+			name:    "postgres",
+			factory: newPostgresStandIn,
+		},
+		{
+			name:    "sqlite",
+			factory: NewSQLiteTransactionLogger,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempFile := filepath.Join(t.TempDir(), "transaction.log")
+			fl, err := tt.factory(tempFile)
+			assert.NoError(t, err)
+			err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+			assert.NoError(t, err)
+
+			// the queued events are written before close returns
+			for i := 0; i < 100; i++ {
+				fl.WritePut(fmt.Sprintf("key-%d", i), "value", 1)
+			}
+			err = fl.Close(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(100), fl.GetLastEventId())
+
+			err = fl.WritePutContext(context.Background(), "late", "value", 1, time.Time{})
+			assert.ErrorIs(t, err, ErrLoggerClosed)
+			fl.WriteDel("late", 1)
+			err = fl.Close(context.Background())
+			assert.NoError(t, err)
+
+			restarted, err := tt.factory(tempFile)
+			assert.NoError(t, err)
+			kvstore := store.NewKVStore()
+			err = InitalizeTrasactionLogger(restarted, kvstore, nil)
+			assert.NoError(t, err)
+			assert.Len(t, kvstore.Snapshot(), 100)
+		})
+	}
+}
+
+// newPostgresStandIn logs to an in memory db speaking the postgres dialect,
+// loggers created with the same name share the db. ramsql cannot run the
+// migrations, so the schema is created as on a new db and recorded as
+// migrated, TestPostgresMigrations runs them against a real db
+func newPostgresStandIn(name string) (TransactionLogger, error) {
+	db, err := sql.Open("ramsql", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INT PRIMARY KEY)`); err != nil {
+		return nil, err
+	}
+	if err := applyMigration(db, len(postgresMigrations)-1, postgresSchema...); err != nil {
+		return nil, err
+	}
+	return NewPostgresTransactionLoggerFromDB(db)
+}
+
+func TestPostgresTransactionLogger(t *testing.T) {
+	name := t.Name()
+	fl, err := newPostgresStandIn(name)
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	err = fl.WritePutContext(ctx, "a", "tab\tand\nnewline 'quoted'", 1, time.Time{})
+	assert.NoError(t, err)
+	err = fl.WriteBatchContext(ctx, []Event{
+		{EventType: EventPut, Key: "b", Value: "2", Version: 1},
+		{EventType: EventDelete, Key: "a"},
+	})
+	assert.NoError(t, err)
+	err = fl.WriteDelContext(ctx, "b", 1)
+	assert.NoError(t, err)
+
+	eventChan, errorChan := fl.ReadEvents()
+	var got []Event
+	for e := range eventChan {
+		got = append(got, e)
+	}
+	assert.NoError(t, <-errorChan)
+
+	// the entries of the batch take sequence numbers of their own
+	assert.Equal(t, []Event{
+		{Id: 1, EventType: EventPut, Key: "a", Value: "tab\tand\nnewline 'quoted'", Version: 1},
+		{Id: 2, EventType: EventBatch, Batch: []Event{
+			{EventType: EventPut, Key: "b", Value: "2", Version: 1},
+			{EventType: EventDelete, Key: "a"},
+		}},
+		{Id: 5, EventType: EventDelete, Key: "b", Version: 1},
+	}, got)
+	assert.Equal(t, uint64(5), fl.GetLastEventId())
+
+	// every migration is recorded, a restart applies none of them again
+	db, err := sql.Open("ramsql", name)
+	assert.NoError(t, err)
+	var version int
+	err = db.QueryRow(`SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`).Scan(&version)
+	assert.NoError(t, err)
+	assert.Equal(t, len(postgresMigrations)-1, version)
+
+	restarted, err := newPostgresStandIn(name)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), restarted.GetLastEventId())
+
+	// compaction is recorded so readers see the marker
+	err = restarted.Compact(4)
+	assert.NoError(t, err)
+	eventChan, _ = restarted.ReadEvents()
+	got = got[:0]
+	for e := range eventChan {
+		got = append(got, e)
+	}
+	assert.Equal(t, []Event{
+		{Id: 4, EventType: EventCompacted},
+		{Id: 5, EventType: EventDelete, Key: "b", Version: 1},
+	}, got)
+}
+
+// openTestPostgres returns a connection string to a schema of its own on the
+// db of KV_TEST_POSTGRES, the test is skipped if it is not set
+func openTestPostgres(t *testing.T) string {
+	connStr := os.Getenv("KV_TEST_POSTGRES")
+	if connStr == "" {
+		t.Skip("KV_TEST_POSTGRES is not set")
+	}
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "kv_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		db.Close()
+	})
+
+	// lib/pq sends unknown parameters as run time parameters of the session
+	if u, err := url.Parse(connStr); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return connStr + " search_path=" + schema
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	baseline := []string{
+		postgresMigrations[1],
+		`INSERT INTO transactions (event_type, "key", value) VALUES (0, 'a', '1')`,
+	}
+
+	tests := []struct {
+		name  string
+		setup []string // run on the db before the logger opens it
+		keys  int      // replayed from the setup
+	}{
+		{name: "new db"},
+		{name: "baseline table", setup: baseline, keys: 1},
+		{
+			name: "migrations recorded",
+			setup: append(baseline,
+				postgresMigrations[2],
+				`CREATE TABLE schema_migrations (version INT PRIMARY KEY)`,
+				`INSERT INTO schema_migrations (version) VALUES (1), (2)`,
+			),
+			keys: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			connStr := openTestPostgres(t)
+			db, err := sql.Open("postgres", connStr)
+			assert.NoError(t, err)
+			for _, statement := range tc.setup {
+				_, err = db.Exec(statement)
+				assert.NoError(t, err)
+			}
+
+			fl, err := NewPostgresTransactionLoggerFromDB(db)
+			assert.NoError(t, err)
+			kvstore := store.NewKVStore()
+			assert.NoError(t, InitalizeTrasactionLogger(fl, kvstore, nil))
+			assert.Len(t, kvstore.Snapshot(), tc.keys)
+			if tc.keys > 0 {
+				value, version, err := kvstore.Get("a")
+				assert.NoError(t, err)
+				assert.Equal(t, "1", value)
+				assert.Equal(t, uint64(1), version)
+			}
+			assert.NoError(t, fl.WritePutContext(context.Background(), "b", "2", 1, time.Time{}))
+			assert.NoError(t, fl.Close(context.Background()))
+
+			// every version is recorded once, a restart applies none of them again
+			db, err = sql.Open("postgres", connStr)
+			assert.NoError(t, err)
+			restarted, err := NewPostgresTransactionLoggerFromDB(db)
+			assert.NoError(t, err)
+			defer restarted.Close(context.Background())
+			kvstore = store.NewKVStore()
+			assert.NoError(t, InitalizeTrasactionLogger(restarted, kvstore, nil))
+			assert.Len(t, kvstore.Snapshot(), tc.keys+1)
+
+			check, err := sql.Open("postgres", connStr)
+			assert.NoError(t, err)
+			defer check.Close()
+			rows, err := check.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+			assert.NoError(t, err)
+			defer rows.Close()
+			var versions, want []int
+			for v := 1; v < len(postgresMigrations); v++ {
+				want = append(want, v)
+			}
+			for rows.Next() {
+				var version int
+				assert.NoError(t, rows.Scan(&version))
+				versions = append(versions, version)
+			}
+			assert.Equal(t, want, versions)
+		})
+	}
+}
+
+func TestSQLiteTransactionLogger(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "transaction.db")
+	fl, err := NewSQLiteTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	err = InitalizeTrasactionLogger(fl, store.NewKVStore(), nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	err = fl.WritePutContext(ctx, "a", "tab\tand\nnewline 'quoted'", 1, time.Time{})
+	assert.NoError(t, err)
+	err = fl.WriteBatchContext(ctx, []Event{
+		{EventType: EventPut, Key: "b", Value: "2", Version: 1},
+		{EventType: EventDelete, Key: "a"},
+	})
+	assert.NoError(t, err)
+	err = fl.WriteDelContext(ctx, "b", 1)
+	assert.NoError(t, err)
+
+	// the log is a plain db in WAL mode, readable while it is written
+	db, err := sql.Open("sqlite", tempFile)
+	assert.NoError(t, err)
+	defer db.Close()
+	var mode string
+	err = db.QueryRow(`PRAGMA journal_mode`).Scan(&mode)
+	assert.NoError(t, err)
+	assert.Equal(t, "wal", mode)
+	var rows int
+	err = db.QueryRow(`SELECT COUNT(*) FROM transactions WHERE batch = 2`).Scan(&rows)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rows)
+
+	err = fl.Compact(4)
+	assert.NoError(t, err)
+	err = fl.Close(ctx)
+	assert.NoError(t, err)
+
+	// compacted sequence numbers are not handed out again
+	restarted, err := NewSQLiteTransactionLogger(tempFile)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), restarted.GetLastEventId())
+	restarted.Run()
+	err = restarted.Compact(5)
+	assert.NoError(t, err)
+	err = restarted.WritePutContext(ctx, "c", "3", 1, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), restarted.GetLastEventId())
+
+	eventChan, errorChan := restarted.ReadEvents()
+	var got []Event
+	for e := range eventChan {
+		got = append(got, e)
+	}
+	assert.NoError(t, <-errorChan)
+	assert.Equal(t, []Event{
+		{Id: 5, EventType: EventCompacted},
+		{Id: 6, EventType: EventPut, Key: "c", Value: "3", Version: 1},
+	}, got)
+}
@@ -27,6 +27,9 @@ type Event struct {
 	EventType     uint32                 `protobuf:"varint,2,opt,name=eventType,proto3" json:"eventType,omitempty"`
 	Key           string                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
 	Value         string                 `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`
+	ExpiresAt     int64                  `protobuf:"varint,5,opt,name=expiresAt,proto3" json:"expiresAt,omitempty"` // unix nano, 0 means the key never expires
+	Version       uint64                 `protobuf:"varint,6,opt,name=version,proto3" json:"version,omitempty"`     // version of the key after a put
+	Batch         []*Event               `protobuf:"bytes,7,rep,name=batch,proto3" json:"batch,omitempty"`          // entries of a batch event
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -89,16 +92,242 @@ func (x *Event) GetValue() string {
 	return ""
 }
 
+func (x *Event) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *Event) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Event) GetBatch() []*Event {
+	if x != nil {
+		return x.Batch
+	}
+	return nil
+}
+
+type Snapshot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LastEventId   uint64                 `protobuf:"varint,1,opt,name=lastEventId,proto3" json:"lastEventId,omitempty"` // the store reflects every event up to this id
+	Entries       []*Event               `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries,omitempty"`          // one put per live key
+	Revision      uint64                 `protobuf:"varint,3,opt,name=revision,proto3" json:"revision,omitempty"`       // version of the last write to the store
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Snapshot) Reset() {
+	*x = Snapshot{}
+	mi := &file_proto_transactionLogger_transactionLogger_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Snapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Snapshot) ProtoMessage() {}
+
+func (x *Snapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_transactionLogger_transactionLogger_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Snapshot.ProtoReflect.Descriptor instead.
+func (*Snapshot) Descriptor() ([]byte, []int) {
+	return file_proto_transactionLogger_transactionLogger_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Snapshot) GetLastEventId() uint64 {
+	if x != nil {
+		return x.LastEventId
+	}
+	return 0
+}
+
+func (x *Snapshot) GetEntries() []*Event {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *Snapshot) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type Segment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`
+	FirstEventId  uint64                 `protobuf:"varint,2,opt,name=firstEventId,proto3" json:"firstEventId,omitempty"`
+	LastEventId   uint64                 `protobuf:"varint,3,opt,name=lastEventId,proto3" json:"lastEventId,omitempty"`
+	Events        uint64                 `protobuf:"varint,4,opt,name=events,proto3" json:"events,omitempty"`
+	Size          int64                  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"` // bytes
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Segment) Reset() {
+	*x = Segment{}
+	mi := &file_proto_transactionLogger_transactionLogger_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Segment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Segment) ProtoMessage() {}
+
+func (x *Segment) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_transactionLogger_transactionLogger_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Segment.ProtoReflect.Descriptor instead.
+func (*Segment) Descriptor() ([]byte, []int) {
+	return file_proto_transactionLogger_transactionLogger_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Segment) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Segment) GetFirstEventId() uint64 {
+	if x != nil {
+		return x.FirstEventId
+	}
+	return 0
+}
+
+func (x *Segment) GetLastEventId() uint64 {
+	if x != nil {
+		return x.LastEventId
+	}
+	return 0
+}
+
+func (x *Segment) GetEvents() uint64 {
+	if x != nil {
+		return x.Events
+	}
+	return 0
+}
+
+func (x *Segment) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+// index of the closed segments of a segmented log
+type SegmentIndex struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	CompactedEventId uint64                 `protobuf:"varint,1,opt,name=compactedEventId,proto3" json:"compactedEventId,omitempty"` // events up to this id were dropped by compaction
+	Segments         []*Segment             `protobuf:"bytes,2,rep,name=segments,proto3" json:"segments,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *SegmentIndex) Reset() {
+	*x = SegmentIndex{}
+	mi := &file_proto_transactionLogger_transactionLogger_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SegmentIndex) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SegmentIndex) ProtoMessage() {}
+
+func (x *SegmentIndex) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_transactionLogger_transactionLogger_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SegmentIndex.ProtoReflect.Descriptor instead.
+func (*SegmentIndex) Descriptor() ([]byte, []int) {
+	return file_proto_transactionLogger_transactionLogger_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SegmentIndex) GetCompactedEventId() uint64 {
+	if x != nil {
+		return x.CompactedEventId
+	}
+	return 0
+}
+
+func (x *SegmentIndex) GetSegments() []*Segment {
+	if x != nil {
+		return x.Segments
+	}
+	return nil
+}
+
 var File_proto_transactionLogger_transactionLogger_proto protoreflect.FileDescriptor
 
 const file_proto_transactionLogger_transactionLogger_proto_rawDesc = "" +
 	"\n" +
-	"/proto/transactionLogger/transactionLogger.proto\x12\x0eprotobufLogger\"]\n" +
+	"/proto/transactionLogger/transactionLogger.proto\x12\x0eprotobufLogger\"\xc2\x01\n" +
 	"\x05Event\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x1c\n" +
 	"\teventType\x18\x02 \x01(\rR\teventType\x12\x10\n" +
 	"\x03key\x18\x03 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x04 \x01(\tR\x05valueB\x18Z\x16./proto/protobufLoggerb\x06proto3"
+	"\x05value\x18\x04 \x01(\tR\x05value\x12\x1c\n" +
+	"\texpiresAt\x18\x05 \x01(\x03R\texpiresAt\x12\x18\n" +
+	"\aversion\x18\x06 \x01(\x04R\aversion\x12+\n" +
+	"\x05batch\x18\a \x03(\v2\x15.protobufLogger.EventR\x05batch\"y\n" +
+	"\bSnapshot\x12 \n" +
+	"\vlastEventId\x18\x01 \x01(\x04R\vlastEventId\x12/\n" +
+	"\aentries\x18\x02 \x03(\v2\x15.protobufLogger.EventR\aentries\x12\x1a\n" +
+	"\brevision\x18\x03 \x01(\x04R\brevision\"\x8d\x01\n" +
+	"\aSegment\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\"\n" +
+	"\ffirstEventId\x18\x02 \x01(\x04R\ffirstEventId\x12 \n" +
+	"\vlastEventId\x18\x03 \x01(\x04R\vlastEventId\x12\x16\n" +
+	"\x06events\x18\x04 \x01(\x04R\x06events\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\"o\n" +
+	"\fSegmentIndex\x12*\n" +
+	"\x10compactedEventId\x18\x01 \x01(\x04R\x10compactedEventId\x123\n" +
+	"\bsegments\x18\x02 \x03(\v2\x17.protobufLogger.SegmentR\bsegmentsB\x18Z\x16./proto/protobufLoggerb\x06proto3"
 
 var (
 	file_proto_transactionLogger_transactionLogger_proto_rawDescOnce sync.Once
@@ -112,16 +341,22 @@ func file_proto_transactionLogger_transactionLogger_proto_rawDescGZIP() []byte {
 	return file_proto_transactionLogger_transactionLogger_proto_rawDescData
 }
 
-var file_proto_transactionLogger_transactionLogger_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_transactionLogger_transactionLogger_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_proto_transactionLogger_transactionLogger_proto_goTypes = []any{
-	(*Event)(nil), // 0: protobufLogger.Event
+	(*Event)(nil),        // 0: protobufLogger.Event
+	(*Snapshot)(nil),     // 1: protobufLogger.Snapshot
+	(*Segment)(nil),      // 2: protobufLogger.Segment
+	(*SegmentIndex)(nil), // 3: protobufLogger.SegmentIndex
 }
 var file_proto_transactionLogger_transactionLogger_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0, // 0: protobufLogger.Event.batch:type_name -> protobufLogger.Event
+	0, // 1: protobufLogger.Snapshot.entries:type_name -> protobufLogger.Event
+	2, // 2: protobufLogger.SegmentIndex.segments:type_name -> protobufLogger.Segment
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_proto_transactionLogger_transactionLogger_proto_init() }
@@ -135,7 +370,7 @@ func file_proto_transactionLogger_transactionLogger_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_transactionLogger_transactionLogger_proto_rawDesc), len(file_proto_transactionLogger_transactionLogger_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   1,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   0,
 		},